@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Exponential backoff with full jitter. The zero value is not usable; set
+// Min and Max before calling Next.
+//
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	attempt int
+}
+
+// Returns the delay before the next attempt and advances the backoff.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.Min << b.attempt
+	if ceiling <= 0 || ceiling > b.Max {
+		ceiling = b.Max
+	} else {
+		b.attempt++
+	}
+	if ceiling <= b.Min {
+		return b.Min
+	}
+	return b.Min + rand.N(ceiling-b.Min)
+}
+
+// Start over from the minimum delay after a success.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// How a monster fights on its turn. Behaviors are registered by name in
+// Behaviors and chosen per monster by the behavior field in the bestiary.
+type Behavior interface {
+	// Relative chance of attacking a member who is standing or downed. The
+	// taunter is the member who goaded the monster this round, if any.
+	TargetWeight(pc Character, taunted bool) float64
+
+	// Take the turn against the chosen target.
+	Act(g *GameServer, c *Combat, target string)
+}
+
+var Behaviors = map[string]Behavior{
+	"brute":      Brute{},
+	"skulker":    Skulker{},
+	"webspinner": Webspinner{},
+	"berserker":  Berserker{},
+	"smasher":    Smasher{},
+}
+
+const (
+	// Taunting makes a member this many times as likely to be attacked.
+	TauntWeight = 4.0
+
+	// A member at 0 HP left of their max is this many times as likely to be
+	// attacked, on top of their base chance.
+	WoundedWeight = 2.0
+
+	// Downed goblins are less of a threat, so less of a target.
+	DownedWeight = 0.5
+)
+
+// Goes for whoever taunts it or looks weakest, and hits them.
+type Brute struct{}
+
+func (Brute) TargetWeight(pc Character, taunted bool) float64 {
+	w := 1 + WoundedWeight*Wounds(pc)
+	if taunted {
+		w *= TauntWeight
+	}
+	if pc.Vitality == Downed {
+		w *= DownedWeight
+	}
+	return w
+}
+
+func (Brute) Act(g *GameServer, c *Combat, target string) {
+	g.MonsterAttack(c, target, c.Monster.Attack)
+}
+
+// Fraction of a character's HP lost, from 0 to 1.
+func Wounds(pc Character) float64 {
+	if pc.HPMax <= 0 {
+		return 0
+	}
+	return float64(pc.HPMax-pc.HP) / float64(pc.HPMax)
+}
+
+// Picks off the wounded.
+type Skulker struct{ Brute }
+
+func (Skulker) TargetWeight(pc Character, taunted bool) float64 {
+	w := 1 + 3*WoundedWeight*Wounds(pc)
+	if taunted {
+		w *= TauntWeight
+	}
+	if pc.Vitality == Downed {
+		w *= DownedWeight
+	}
+	return w
+}
+
+// Sometimes webs its target instead of biting. A webbed goblin loses their
+// next action.
+type Webspinner struct{ Brute }
+
+const WebChance = 0.3
+
+func (b Webspinner) Act(g *GameServer, c *Combat, target string) {
+	if c.Webbed[target] || g.Rand.Float64() >= WebChance {
+		b.Brute.Act(g, c, target)
+		return
+	}
+	c.Webbed[target] = true
+	g.Say(PriorityNormal, "The "+c.Monster.Name+" wraps "+g.Party.Name(target)+" in sticky webbing!")
+}
+
+// Attacks twice once badly hurt.
+type Berserker struct{ Brute }
+
+func (b Berserker) Act(g *GameServer, c *Combat, target string) {
+	b.Brute.Act(g, c, target)
+	if c.Monster.HP*2 > c.Monster.HPMax {
+		return
+	}
+	// The first blow may have killed the target, who leaves the party.
+	targets := g.Targets()
+	if len(targets) == 0 {
+		return
+	}
+	if !slices.Contains(targets, target) {
+		target = g.PickTarget(c, b, targets)
+	}
+	g.Say(PriorityNormal, "The "+c.Monster.Name+" flies into a rage!")
+	b.Brute.Act(g, c, target)
+}
+
+// Sometimes winds up a blow that rolls its damage twice.
+type Smasher struct{ Brute }
+
+const SmashChance = 0.25
+
+func (b Smasher) Act(g *GameServer, c *Combat, target string) {
+	if g.Rand.Float64() >= SmashChance {
+		b.Brute.Act(g, c, target)
+		return
+	}
+	smash := c.Monster.Attack
+	smash.Count *= 2
+	if smash.Keep > 0 {
+		smash.Keep *= 2
+	}
+	g.Say(PriorityNormal, "The "+c.Monster.Name+" winds up a mighty blow!")
+	g.MonsterAttack(c, target, smash)
+}
+
+// Weighted random choice among members still standing.
+func (g *GameServer) PickTarget(c *Combat, b Behavior, standing []string) string {
+	weights := make([]float64, len(standing))
+	total := 0.0
+	for i, uid := range standing {
+		weights[i] = b.TargetWeight(g.Party.PlayerCharacters[uid], uid == c.Taunter)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return standing[g.Rand.IntN(len(standing))]
+	}
+	r := g.Rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return standing[i]
+		}
+		r -= w
+	}
+	return standing[len(standing)-1]
+}
+
+// Roll damage against the target's defense.
+func (g *GameServer) MonsterAttack(c *Combat, target string, attack Dice) {
+	pc, ok := g.Party.PlayerCharacters[target]
+	if !ok {
+		return
+	}
+
+	damage := max(0, attack.Roll(g.Rand)-pc.Defense)
+	if damage == 0 {
+		g.Say(PriorityNormal, "The "+c.Monster.Name+" misses "+pc.Name+".")
+		return
+	}
+	g.Say(PriorityNormal, fmt.Sprintf("The %s hits %s for %d.", c.Monster.Name, pc.Name, damage))
+	g.Hurt(target, damage)
+}
+
+// Fractions of max HP at which a monster checks morale. The first check
+// comes with the first wound.
+var MoraleThresholds = []float64{1, 0.5, 0.25}
+
+// Check morale for every threshold the monster has fallen past since the
+// last check. Returns true if its nerve breaks: 2d6 over its morale.
+func (g *GameServer) CheckMorale(c *Combat) bool {
+	broken := false
+	for c.MoraleChecks < len(MoraleThresholds) {
+		threshold := MoraleThresholds[c.MoraleChecks]
+		if float64(c.Monster.HP) >= threshold*float64(c.Monster.HPMax) {
+			break
+		}
+		c.MoraleChecks++
+		if MoraleDice.Roll(g.Rand) > c.Monster.Morale {
+			broken = true
+		}
+	}
+	return broken
+}
+
+var MoraleDice = MustParseDice("2d6")
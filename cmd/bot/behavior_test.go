@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPickTargetWeights(t *testing.T) {
+	g, _ := newTestCombat(t, testMonster())
+	c := g.Delve.Combat
+	standing := g.Standing()
+
+	count := func(b Behavior) int {
+		alice := 0
+		for range 2000 {
+			if g.PickTarget(c, b, standing) == "1" {
+				alice++
+			}
+		}
+		return alice
+	}
+
+	c.Taunter = "1"
+	if n := count(Brute{}); n < 1400 {
+		t.Fatalf("taunter attacked %d of 2000 times", n)
+	}
+
+	c.Taunter = ""
+	alice := g.Party.PlayerCharacters["1"]
+	alice.HP = 1
+	alice.HPMax = 10
+	g.Party.PlayerCharacters["1"] = alice
+	brute, skulker := count(Brute{}), count(Skulker{})
+	if brute < 1100 || skulker <= brute {
+		t.Fatalf("wounded attacked %d times by a brute, %d by a skulker", brute, skulker)
+	}
+}
+
+func TestMoraleThresholds(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax, m.Morale = 10, 10, 12
+	g, _ := newTestCombat(t, m)
+	c := g.Delve.Combat
+
+	if g.CheckMorale(c) || c.MoraleChecks != 0 {
+		t.Fatal("unhurt monster checked morale")
+	}
+	c.Monster.HP = 9
+	g.CheckMorale(c)
+	if c.MoraleChecks != 1 {
+		t.Fatalf("first wound made %d checks", c.MoraleChecks)
+	}
+	c.Monster.HP = 2
+	if g.CheckMorale(c) || c.MoraleChecks != 3 {
+		t.Fatalf("morale 12 broke, or %d checks made", c.MoraleChecks)
+	}
+}
+
+func TestMonsterFleeGivesOneRound(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	m.Morale = 1
+	g, now := newTestCombat(t, m)
+	g.Delve.Room().Monster = true
+
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	sendCommand(t, g, "2", "Bob", "!attack", now)
+	if g.Delve.Combat == nil || !g.Delve.Combat.Fleeing {
+		t.Fatal("monster with broken morale should try to flee")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "turns to flee") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!taunt", now)
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	if g.Delve.Combat != nil || g.Delve.Room().Monster || g.Delve.Vote == nil {
+		t.Fatal("monster should escape after one round")
+	}
+	if g.Delve.Shinies != 0 {
+		t.Fatal("escaped monster dropped loot")
+	}
+}
+
+func TestWebbedLosesAction(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+	g.Delve.Combat.Webbed["1"] = true
+
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	if g.Delve.Combat.Monster.HP != 100 {
+		t.Fatal("webbed goblin still attacked")
+	}
+	if g.Delve.Combat.Webbed["1"] {
+		t.Fatal("web should last one action")
+	}
+}
+
+func TestBerserkerLeavesTheDead(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 1, 10
+	m.Attack = MustParseDice("3d1")
+	g, _ := newTestCombat(t, m)
+	alice := g.Party.PlayerCharacters["1"]
+	alice.HP, alice.Might, alice.Defense = 0, 1, 0
+	alice.Vitality = Downed
+	g.Party.PlayerCharacters["1"] = alice
+
+	Berserker{}.Act(g, g.Delve.Combat, "1")
+	if _, ok := g.Party.PlayerCharacters["1"]; ok {
+		t.Fatal("dead goblin is still in the party")
+	}
+	chat := drainChat(g)
+	if !strings.Contains(chat, "Alice has died!") || !strings.Contains(chat, "flies into a rage") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	rage := chat[strings.Index(chat, "flies into a rage"):]
+	if strings.Contains(rage, "Alice") || !strings.Contains(rage, "Bob") {
+		t.Fatalf("second attack did not go to Bob:\n%s", rage)
+	}
+}
+
+func TestBestiaryBehaviors(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+
+	for id := 1; ; id++ {
+		m, err := g.LoadMonster(id)
+		if id > 1 && err != nil {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if m.Behavior == nil {
+			t.Fatalf("%s has no behavior", m.Name)
+		}
+	}
+}
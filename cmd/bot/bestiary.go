@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoMonster = errors.New("bestiary: no monster for this level")
+
+type Monster struct {
+	ID   int
+	Name string
+
+	HP    int
+	HPMax int
+
+	Attack  Dice
+	Defense int
+
+	Morale    int     // 2d6 must roll at most this to keep fighting
+	Awareness float64 // Chance to notice the party first
+	Behavior
+
+	XP          int
+	LootTableID int
+}
+
+func (g *GameServer) LoadMonster(id int) (Monster, error) {
+	var attack, behavior string
+	m := Monster{ID: id}
+	err := g.Query[QueryMonster].QueryRow(id).Scan(
+		&m.Name, &m.HP, &m.Defense, &attack, &m.Morale,
+		&m.Awareness, &m.XP, &m.LootTableID, &behavior,
+	)
+	if err != nil {
+		return m, fmt.Errorf("load monster %d: %w", id, err)
+	}
+	b, ok := Behaviors[behavior]
+	if !ok {
+		return m, fmt.Errorf("load monster %d: unknown behavior %q", id, behavior)
+	}
+	m.Behavior = b
+	m.HPMax = m.HP
+	m.Attack, err = ParseDice(attack)
+	if err != nil {
+		return m, fmt.Errorf("load monster %d: %w", id, err)
+	}
+	return m, nil
+}
+
+// A random monster that belongs on this dungeon level.
+func (g *GameServer) PickMonster(level int) (Monster, error) {
+	rows, err := g.Query[QueryMonsterList].Query(level)
+	if err != nil {
+		return Monster{}, err
+	}
+	ids := make([]int, 0, 8)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return Monster{}, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return Monster{}, fmt.Errorf("%w %d", ErrNoMonster, level)
+	}
+	return g.LoadMonster(ids[g.Rand.IntN(len(ids))])
+}
+
+// Roll the monster's loot table for shinies and item drops.
+func (g *GameServer) RollLoot(m Monster) (int, []Item, error) {
+	var shinies string
+	err := g.Query[QueryLootTable].QueryRow(m.LootTableID).Scan(&shinies)
+	if err != nil {
+		return 0, nil, fmt.Errorf("loot of %s: %w", m.Name, err)
+	}
+	dice, err := ParseDice(shinies)
+	if err != nil {
+		return 0, nil, fmt.Errorf("loot of %s: %w", m.Name, err)
+	}
+	found := max(0, dice.Roll(g.Rand))
+
+	rows, err := g.Query[QueryLootDrops].Query(m.LootTableID)
+	if err != nil {
+		return found, nil, fmt.Errorf("loot of %s: %w", m.Name, err)
+	}
+	defer rows.Close()
+	drops := make([]Item, 0, 2)
+	for rows.Next() {
+		var item Item
+		var chance float64
+		if err := rows.Scan(&item.ID, &item.Name, &item.Appearance, &chance); err != nil {
+			return found, drops, fmt.Errorf("loot of %s: %w", m.Name, err)
+		}
+		if g.Rand.Float64() < chance {
+			drops = append(drops, item)
+		}
+	}
+	return found, drops, nil
+}
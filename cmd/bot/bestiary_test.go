@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestPickMonsterByLevel(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+	g.Rand = rand.New(rand.NewPCG(3, 4))
+
+	seen := make(map[string]bool)
+	for range 100 {
+		m, err := g.PickMonster(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Name == "Ogre" || m.Name == "Skeleton" {
+			t.Fatalf("%s is too tough for level 1", m.Name)
+		}
+		if m.HP != m.HPMax || m.HP <= 0 || m.Attack.Count == 0 || m.LootTableID == 0 {
+			t.Fatalf("monster not fully loaded: %+v", m)
+		}
+		seen[m.Name] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("level 1 always has the same monster: %v", seen)
+	}
+
+	if _, err := g.PickMonster(100); !errors.Is(err, ErrNoMonster) {
+		t.Fatalf("expected ErrNoMonster, got %v", err)
+	}
+}
+
+func TestMonsterRoomAndLoot(t *testing.T) {
+	g, now := newTestDelve(t)
+	g.Delve.Vote = nil
+
+	room := g.Delve.Room()
+	room.Monster = true
+	g.EnterRoom(now)
+	if g.Delve.Encounter != nil {
+		sendCommand(t, g, "1", "Alice", "!attack", now)
+		sendCommand(t, g, "2", "Bob", "!attack", now)
+	}
+	if g.Delve.Combat == nil || room.MonsterID == 0 {
+		t.Fatal("entering a monster's room should start combat")
+	}
+	first := room.MonsterID
+
+	g.Delve.Combat.Monster.HP = 1
+	g.Delve.Combat.Monster.Defense = -100
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	sendCommand(t, g, "2", "Bob", "!attack", now)
+	if g.Delve.Combat != nil || room.Monster || room.MonsterID != first {
+		t.Fatal("slain monster should leave the room empty")
+	}
+	if g.Delve.BonusXP() == 0 || g.Delve.Shinies == 0 {
+		t.Fatalf("no reward for the kill: %d XP, %d shinies", g.Delve.BonusXP(), g.Delve.Shinies)
+	}
+
+	total := g.Delve.Shinies + g.Delve.BonusXP()
+	alice := g.Party.PlayerCharacters["1"].ID
+	sendCommand(t, g, "1", "Alice", "!home", now)
+	sendCommand(t, g, "2", "Bob", "!home", now)
+	if g.Phase != PhaseTown {
+		t.Fatal("party did not return home")
+	}
+
+	var xp int
+	err := g.DB.QueryRow("SELECT experience FROM Character WHERE id = ?", alice).Scan(&xp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xp != total/2 {
+		t.Fatalf("Alice has %d XP, want %d", xp, total/2)
+	}
+}
@@ -1,4 +1,3 @@
-// TODO: Automatically refresh tokens https://dev.twitch.tv/docs/authentication/refresh-tokens/
 package main
 
 import (
@@ -14,13 +13,13 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
-	"golang.org/x/oauth2/twitch"
 )
 
 var (
@@ -29,17 +28,19 @@ var (
 		"user:write:chat",
 		"user:bot",
 	}
-)
 
-type UserToken struct {
-	oauth2.Token
-	Scope []string `json:"scope"`
-}
+	// EventSub connection timing. Twitch sends the welcome right after the
+	// connection opens and a keepalive whenever the session is idle.
+	EventSubWelcomeTimeout = 10 * time.Second
+	EventSubKeepaliveGrace = 5 * time.Second
+	EventSubBackoffMin     = time.Second
+	EventSubBackoffMax     = 2 * time.Minute
+)
 
 type ChatBot struct {
-	GameMessageIn chan string // For getting messages from the game server
+	Outbox *Outbox // For getting messages from the game server
 
-	GameCommandOut chan string // For sending commands to the game server
+	GameCommandOut chan Command // For sending commands to the game server
 	GameInterrupt  chan os.Signal
 	GameDone       chan struct{}
 
@@ -50,6 +51,9 @@ type ChatBot struct {
 
 	CommandPrefix byte
 
+	AuthURL string // Base URL of the Twitch OAuth server
+	APIURL  string // Base URL of the Twitch Helix API
+
 	clientSecret string
 	oauth2Config *clientcredentials.Config
 
@@ -57,33 +61,62 @@ type ChatBot struct {
 	userToken   *UserToken    // Requires bot account user authentication
 	authCode    string
 
+	TokenFile      string // Where the user token is persisted between runs
+	tokenMu        sync.Mutex
+	refreshMu      sync.Mutex
+	tokenValidated time.Time
+
 	shutdown chan bool
 
-	conn *websocket.Conn
+	EventSubURL  string        // Where new EventSub sessions are opened
+	keepalive    time.Duration // From the session welcome message
+	reconnectURL string        // Set by a session_reconnect message
+	dialing      bool
+	dialed       chan wsDial
+	frames       chan wsFrame
+	quit         chan struct{}
+
+	conn    *websocket.Conn
+	pending *websocket.Conn // Reconnect connection awaiting its welcome
 }
 
-func NewChatBot(g *GameServer) *ChatBot {
+func NewChatBot(flow AuthFlow) *ChatBot {
 	b := &ChatBot{
-		GameMessageIn: make(chan string, 32),
 		CommandPrefix: '!',
+		AuthURL:       TwitchAuthURL,
+		APIURL:        TwitchAPIURL,
+		EventSubURL:   TwitchEventSubURL,
+		TokenFile:     GetPathPrefix() + TokenFile,
+		keepalive:     EventSubWelcomeTimeout,
 	}
-	HookBotAndGameServer(b, g)
 	b.GetEnvironmentVariables()
-	b.MakeAuthRequest()
-	b.GetUserAuthToken()
+	if !b.LoadUserAuthToken() {
+		b.Authorize(flow)
+	}
 	//b.GetClientAuthToken()
 
 	return b
 }
 
-func HookBotAndGameServer(b *ChatBot, g *GameServer) {
-	g.MessagesOut = b.GameMessageIn
+func (b *ChatBot) Attach(g *GameServer) {
+	b.Outbox = g.MessagesOut
+	b.Outbox.SetRateLimit(ChatRateLimit)
 
 	b.GameCommandOut = g.CommandsIn
 	b.GameInterrupt = g.Interrupt
 	b.GameDone = g.Shutdown
 }
 
+// Resolve an absolute path against one of the configurable Twitch base URLs.
+func Endpoint(base string, path string) *url.URL {
+	u, err := url.Parse(base)
+	if err != nil {
+		log.Fatalln("Fatal Error! Bad base URL:", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	return u
+}
+
 func (b *ChatBot) GetEnvironmentVariables() {
 	envVars := make(map[string]string)
 
@@ -114,6 +147,18 @@ func (b *ChatBot) GetEnvironmentVariables() {
 	} else if b.clientSecret == "" {
 		log.Fatalln("Fatal Error! CLIENT_SECRET is not present in .env")
 	}
+
+	// Optional overrides for testing against a mock server such as
+	// `twitch mock-api` from the Twitch CLI.
+	if v := envVars["TWITCH_AUTH_URL"]; v != "" {
+		b.AuthURL = v
+	}
+	if v := envVars["TWITCH_API_URL"]; v != "" {
+		b.APIURL = v
+	}
+	if v := envVars["TWITCH_EVENTSUB_URL"]; v != "" {
+		b.EventSubURL = v
+	}
 }
 
 // Creates a link to request authorization from user. Spins up a temporary
@@ -136,12 +181,8 @@ func (b *ChatBot) MakeAuthRequest() {
 	query.WriteString("&scope=" + url.QueryEscape(scopeStr))
 	query.WriteString("&state=" + state)
 
-	reqURL := url.URL{
-		Scheme:   "https",
-		Host:     "id.twitch.tv",
-		Path:     "oauth2/authorize",
-		RawQuery: query.String(),
-	}
+	reqURL := Endpoint(b.AuthURL, "/oauth2/authorize")
+	reqURL.RawQuery = query.String()
 
 	fmt.Print("Click the link below while logged on the bot account to authenticate:\n\n")
 	fmt.Println(reqURL.String())
@@ -205,57 +246,23 @@ func (b *ChatBot) MakeAuthRequest() {
 // Request the short lived user auth token used to control the bot.
 // MUST be called AFTER MakeAuthRequest().
 func (b *ChatBot) GetUserAuthToken() {
-	var body strings.Builder
-
-	body.WriteString("client_id=" + b.ClientID)
-	body.WriteString("&client_secret=" + b.clientSecret)
-	body.WriteString("&code=" + b.authCode)
-	body.WriteString("&grant_type=authorization_code")
-	body.WriteString("&redirect_uri=" + BotURI)
-
-	req := &http.Request{
-		Method: http.MethodPost,
-		URL: &url.URL{
-			Scheme: "https",
-			Host:   "id.twitch.tv",
-			Path:   "/oauth2/token",
-		},
-		Body:   io.NopCloser(strings.NewReader(body.String())),
-		Header: http.Header{},
-	}
-	defer req.Body.Close()
-
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Client-ID", b.ClientID)
-
-	response, err := http.DefaultClient.Do(req)
+	form := url.Values{}
+	form.Set("client_id", b.ClientID)
+	form.Set("client_secret", b.clientSecret)
+	form.Set("code", b.authCode)
+	form.Set("grant_type", "authorization_code")
+	form.Set("redirect_uri", BotURI)
+
+	err := b.requestUserToken(form)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	defer response.Body.Close()
 
-	reqBody, err := io.ReadAll(response.Body)
+	err = b.ValidateUserAuthToken()
 	if err != nil {
 		log.Println(err)
-		return
 	}
-
-	if response.StatusCode != 200 {
-		fmt.Println(string(reqBody))
-		return
-	}
-
-	b.userToken = &UserToken{}
-
-	err = json.Unmarshal(reqBody, b.userToken)
-	if err != nil {
-		log.Println("json:", err)
-	}
-
-	//fmt.Print("\nbot: Token received. Expires in ", float32(b.userToken.ExpiresIn)/3600.0, " hours.\n\n")
-
-	b.ValidateUserAuthToken()
 }
 
 // Obtain a limited (server-to-server) token through the client credentials
@@ -267,7 +274,7 @@ func (b *ChatBot) GetClientAuthToken() {
 	b.oauth2Config = &clientcredentials.Config{
 		ClientID:     b.ClientID,
 		ClientSecret: b.clientSecret,
-		TokenURL:     twitch.Endpoint.TokenURL,
+		TokenURL:     Endpoint(b.AuthURL, "/oauth2/token").String(),
 		Scopes:       BotScopes,
 	}
 
@@ -278,41 +285,60 @@ func (b *ChatBot) GetClientAuthToken() {
 	}
 }
 
+// Checks the user token with Twitch and that it belongs to the bot account.
+// Returns ErrTokenInvalid if Twitch no longer accepts the token.
+//
+// https://dev.twitch.tv/docs/authentication/validate-tokens/
+//
 // MUST be called AFTER GetUserAuthToken()
-func (b *ChatBot) ValidateUserAuthToken() {
-	if b.userToken == nil {
+func (b *ChatBot) ValidateUserAuthToken() error {
+	t := b.currentUserToken()
+	if t == nil {
 		log.Fatal("Error: ValidateUserAuthToken called before GetUserAuthToken")
 	}
 
 	req := &http.Request{
 		Method: "GET",
-		URL: &url.URL{
-			Scheme: "https",
-			Host:   "id.twitch.tv",
-			Path:   "/oauth2/validate",
-		},
+		URL:    Endpoint(b.AuthURL, "/oauth2/validate"),
 		Header: http.Header{},
 	}
 
-	b.userToken.SetAuthHeader(req)
+	t.SetAuthHeader(req)
 	req.Header.Set("Client-ID", b.ClientID)
 
 	response, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
 	defer response.Body.Close()
 
-	// resBody, err := io.ReadAll(response.Body)
-	// if err != nil {
-	// 	log.Println(err)
-	// 	return
-	// }
+	if response.StatusCode == http.StatusUnauthorized {
+		return ErrTokenInvalid
+	}
 
-	//fmt.Println(string(resBody))
-	// TODO Destructure json https://dev.twitch.tv/docs/authentication/validate-tokens/
-	// perform proper validation
+	resBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("validate: %s %s", response.Status, resBody)
+	}
+
+	validation := &JSONTokenValidation{}
+	err = json.Unmarshal(resBody, validation)
+	if err != nil {
+		return err
+	}
+	if validation.ClientID != b.ClientID {
+		return fmt.Errorf("validate: token was issued to client %q", validation.ClientID)
+	}
+	if validation.UserID != b.UserID {
+		return fmt.Errorf("validate: token belongs to user %q, not the bot", validation.UserID)
+	}
+
+	b.tokenValidated = time.Now()
+
+	return nil
 }
 
 // MUST be called AFTER GetClientAuthToken
@@ -323,11 +349,7 @@ func (b *ChatBot) ValidateClientAuthToken() {
 
 	req := &http.Request{
 		Method: "GET",
-		URL: &url.URL{
-			Scheme: "https",
-			Host:   "id.twitch.tv",
-			Path:   "/oauth2/validate",
-		},
+		URL:    Endpoint(b.AuthURL, "/oauth2/validate"),
 		Header: http.Header{},
 	}
 
@@ -355,14 +377,10 @@ func (b *ChatBot) ValidateClientAuthToken() {
 func (b *ChatBot) RequestUserInfo(user string) {
 	req := &http.Request{
 		Method: "GET",
-		URL: &url.URL{
-			Scheme:   "https",
-			Host:     "api.twitch.tv",
-			Path:     "/helix/users",
-			RawQuery: "login=" + user,
-		},
+		URL:    Endpoint(b.APIURL, "/helix/users"),
 		Header: http.Header{},
 	}
+	req.URL.RawQuery = url.Values{"login": {user}}.Encode()
 
 	b.clientToken.SetAuthHeader(req)
 	req.Header.Set("Client-ID", b.ClientID)
@@ -408,23 +426,16 @@ func (b *ChatBot) SendMessage(m string) {
 		return
 	}
 
-	req := &http.Request{
-		Method: http.MethodPost,
-		URL: &url.URL{
-			Scheme: "https",
-			Host:   "api.twitch.tv",
-			Path:   "/helix/chat/messages",
-		},
-		Body:   io.NopCloser(strings.NewReader(string(body))),
-		Header: http.Header{},
-	}
-	defer req.Body.Close()
-
-	b.userToken.SetAuthHeader(req)
-	req.Header.Set("Client-ID", b.ClientID)
-	req.Header.Set("Content-Type", "application/json")
-
-	response, err := http.DefaultClient.Do(req)
+	response, err := b.DoUserRequest(func() (*http.Request, error) {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    Endpoint(b.APIURL, "/helix/chat/messages"),
+			Body:   io.NopCloser(strings.NewReader(string(body))),
+			Header: http.Header{},
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		log.Println(err)
 		return
@@ -435,7 +446,7 @@ func (b *ChatBot) SendMessage(m string) {
 		log.Println(err)
 		return
 	}
-	if response.StatusCode != 202 {
+	if response.StatusCode != http.StatusOK {
 		jsonResponse := &JSONErrorResponse{}
 		err = json.Unmarshal(reqBody, jsonResponse)
 		if err != nil {
@@ -445,14 +456,17 @@ func (b *ChatBot) SendMessage(m string) {
 		log.Println(jsonResponse.Status, jsonResponse.Error, jsonResponse.Message)
 		return
 	}
-	jsonResponse := &JSONResponse{}
+	jsonResponse := &JSONChatMessageResponse{}
 	err = json.Unmarshal(reqBody, jsonResponse)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	resMap := jsonResponse.Data[0]
-	PrettyPrint(resMap)
+	for _, sent := range jsonResponse.Data {
+		if !sent.IsSent {
+			log.Println("chat: Message dropped:", sent.DropReason.Code, sent.DropReason.Message)
+		}
+	}
 }
 
 func (b *ChatBot) RegisterEventSubListeners() {
@@ -489,25 +503,16 @@ func (b *ChatBot) RegisterEventSubListeners() {
 		log.Fatal(err)
 	}
 
-	req := &http.Request{
-		Method: http.MethodPost,
-		URL: &url.URL{
-			Scheme: "https",
-			Host:   "api.twitch.tv",
-			Path:   "/helix/eventsub/subscriptions",
-		},
-		Body:   io.NopCloser(strings.NewReader(string(body))),
-		Header: http.Header{},
-	}
-	defer req.Body.Close()
-
-	// fmt.Println(string(body))
-
-	req.Header.Set("Client-Id", b.ClientID)
-	req.Header.Set("Content-Type", "application/json")
-	b.userToken.SetAuthHeader(req)
-
-	response, err := http.DefaultClient.Do(req)
+	response, err := b.DoUserRequest(func() (*http.Request, error) {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    Endpoint(b.APIURL, "/helix/eventsub/subscriptions"),
+			Body:   io.NopCloser(strings.NewReader(string(body))),
+			Header: http.Header{},
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		log.Println(err)
 		return
@@ -531,25 +536,30 @@ func (b *ChatBot) RegisterEventSubListeners() {
 	}
 }
 
-func (b *ChatBot) ProcessCommand(userID string, username string, text string) {
-	if len(text) == 0 || text[0] != b.CommandPrefix {
-		return
-	}
-	cmd := strings.ToLower(text[1:])
-	admin := userID == b.BroadcasterID
-	if cmd == "shutdown" {
+func (b *ChatBot) ProcessCommand(cmd Command) {
+	admin := cmd.UserID == b.BroadcasterID
+	if cmd.Verb == "shutdown" {
 		if admin {
-			b.shutdown <- true
-			b.GameCommandOut <- "shutdown"
+			b.RequestShutdown()
+			b.GameCommandOut <- cmd
 			return
 		} else {
 			return
 		}
 	}
-	b.GameCommandOut <- strings.Join([]string{userID, username, cmd}, " ")
+	b.GameCommandOut <- cmd
 }
 
-func (b *ChatBot) HandleMessage(m []byte) {
+// Ask Run to stop. Safe to call more than once and from any goroutine.
+func (b *ChatBot) RequestShutdown() {
+	select {
+	case b.shutdown <- true:
+	default:
+	}
+}
+
+// Returns the EventSub message type so Run can track session handoffs.
+func (b *ChatBot) HandleMessage(m []byte) string {
 	msg := &WSMessageType{}
 	err := json.Unmarshal(m, msg)
 	if err != nil {
@@ -563,7 +573,7 @@ func (b *ChatBot) HandleMessage(m []byte) {
 
 	switch msgType {
 	case "session_welcome":
-		session := &WSSessionID{}
+		session := &WSSession{}
 		err := json.Unmarshal(m, session)
 		if err != nil {
 			log.Println("session:", err)
@@ -571,12 +581,43 @@ func (b *ChatBot) HandleMessage(m []byte) {
 		status := session.Payload.Session.Status
 		if status != "connected" {
 			log.Printf("session: Status <%s> -- session not connected.\n", status)
-			b.shutdown <- true
-			return
+			b.RequestShutdown()
+			return msgType
+		}
+		if keepalive := session.Payload.Session.KeepaliveTimeoutSeconds; keepalive > 0 {
+			b.keepalive = time.Duration(keepalive) * time.Second
+		}
+		// A welcome after session_reconnect keeps the old session ID and
+		// its subscriptions. Only a brand new session needs to subscribe.
+		if session.Payload.Session.ID == b.sessionID {
+			log.Println("session: Resumed session", b.sessionID)
+			return msgType
 		}
 		b.sessionID = session.Payload.Session.ID
 		go b.RegisterEventSubListeners()
 
+	case "session_keepalive":
+		// Nothing to do. Any message resets the keepalive watchdog in Run.
+
+	case "session_reconnect":
+		session := &WSSession{}
+		err := json.Unmarshal(m, session)
+		if err != nil {
+			log.Println("session:", err)
+			return msgType
+		}
+		b.reconnectURL = session.Payload.Session.ReconnectURL
+
+	case "revocation":
+		revocation := &WSRevocation{}
+		err := json.Unmarshal(m, revocation)
+		if err != nil {
+			log.Println("revocation:", err)
+			return msgType
+		}
+		sub := revocation.Payload.Subscription
+		log.Printf("revocation: Subscription %s <%s> revoked: %s\n", sub.Type, sub.ID, sub.Status)
+
 	case "notification":
 		subType := msg.Metadata.SubscriptionType
 		switch subType {
@@ -588,19 +629,129 @@ func (b *ChatBot) HandleMessage(m []byte) {
 				log.Println("chat:", err)
 			}
 			event := chat.Payload.Event
-			chatterUserID := event.ChatterUserId
-			chatterUsername := event.ChatterUserName
-			chatText := event.Message.Text
-			b.ProcessCommand(chatterUserID, chatterUsername, chatText)
+			cmd, ok := ParseCommand(b.CommandPrefix, event.Message.Text)
+			if !ok {
+				break
+			}
+			cmd.UserID = event.ChatterUserId
+			cmd.Login = event.ChatterUserLogin
+			cmd.DisplayName = event.ChatterUserName
+			cmd.MessageID = event.MessageId
+			for _, badge := range event.Badges {
+				cmd.Badges = append(cmd.Badges, badge.SetID)
+			}
+			cmd.Timestamp, err = time.Parse(time.RFC3339Nano, chat.Metadata.MessageTimestamp)
+			if err != nil {
+				cmd.Timestamp = time.Now()
+			}
+			b.ProcessCommand(cmd)
 		}
 	}
+
+	return msgType
+}
+
+// A message or read error from one EventSub connection.
+type wsFrame struct {
+	conn *websocket.Conn
+	data []byte
+	err  error
+}
+
+// A freshly dialed EventSub connection. resume is true for connections to a
+// session_reconnect URL, which keep the current session.
+type wsDial struct {
+	conn   *websocket.Conn
+	resume bool
+}
+
+// Dial an EventSub websocket, retrying with exponential backoff until it
+// connects or the bot quits. If a reconnect URL cannot be reached the bot
+// falls back to a brand new session.
+func (b *ChatBot) dialEventSub(wsURL string, resume bool) {
+	backoff := Backoff{Min: EventSubBackoffMin, Max: EventSubBackoffMax}
+	for {
+		log.Printf("websocket: Connecting to %s\n", wsURL)
+		c, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err == nil {
+			select {
+			case b.dialed <- wsDial{conn: c, resume: resume}:
+			case <-b.quit:
+				c.Close()
+			}
+			return
+		}
+		log.Println("dial:", err)
+
+		if resume {
+			wsURL = b.EventSubURL
+			resume = false
+		}
+
+		select {
+		case <-time.After(backoff.Next()):
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Forward every message from c to Run until the connection fails.
+func (b *ChatBot) readEventSub(c *websocket.Conn) {
+	for {
+		_, message, err := c.ReadMessage()
+		select {
+		case b.frames <- wsFrame{conn: c, data: message, err: err}:
+		case <-b.quit:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send queued game messages to chat as fast as the rate limit allows. Runs
+// apart from Run so slow Helix requests never hold up EventSub.
+func (b *ChatBot) sendMessages() {
+	ticker := time.NewTicker(OutboxTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if m, ok := b.Outbox.Pop(now); ok {
+				b.SendMessage(m)
+			}
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Drop the current session and dial a new one in the background.
+func (b *ChatBot) reconnectEventSub() {
+	if b.dialing {
+		return
+	}
+	if b.pending != nil {
+		b.pending.Close()
+		b.pending = nil
+	}
+	b.dialing = true
+	go b.dialEventSub(b.EventSubURL, false)
 }
 
-// TODO: Send chat messages to Twitch
 func (b *ChatBot) Run() {
 
 	interrupt := make(chan os.Signal, 1)
-	b.shutdown = make(chan bool, 1)
+	if b.shutdown == nil {
+		b.shutdown = make(chan bool, 1)
+	}
+	b.frames = make(chan wsFrame, 16)
+	b.dialed = make(chan wsDial)
+	b.quit = make(chan struct{})
+	defer close(b.quit)
 
 	signal.Notify(
 		interrupt,
@@ -611,35 +762,13 @@ func (b *ChatBot) Run() {
 	)
 	defer signal.Reset()
 
-	wsURL := url.URL{Scheme: "wss", Host: EventSubAddr, Path: "/ws"}
-	fmt.Printf("Connecting to %s\n", wsURL.String())
+	// Fires if the server goes quiet for longer than the keepalive timeout.
+	watchdog := time.NewTimer(EventSubWelcomeTimeout)
+	defer watchdog.Stop()
 
-	c, _, err := websocket.DefaultDialer.Dial(wsURL.String(), nil)
-	b.conn = c
-	if err != nil {
-		log.Fatal("dial:", err)
-	}
-	defer c.Close()
-
-	done := make(chan struct{})
-
-	go func() {
-		defer close(done)
-		for {
-			_, message, err := c.ReadMessage()
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			b.HandleMessage(message)
-
-			select {
-			case <-b.shutdown:
-				return
-			default:
-			}
-		}
-	}()
+	b.dialing = true
+	go b.dialEventSub(b.EventSubURL, false)
+	go b.sendMessages()
 
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
@@ -648,37 +777,85 @@ func (b *ChatBot) Run() {
 
 	for alive {
 		select {
-		case <-done:
-			log.Println("websocket: All Done.")
-			alive = false
-		case <-ticker.C:
-			select {
-			case m := <-b.GameMessageIn:
-				b.SendMessage(m)
-			default:
+		case d := <-b.dialed:
+			b.dialing = false
+			go b.readEventSub(d.conn)
+			if d.resume {
+				b.pending = d.conn
+				break
+			}
+			if b.conn != nil {
+				b.conn.Close()
+			}
+			b.conn = d.conn
+			b.sessionID = ""
+			watchdog.Reset(EventSubWelcomeTimeout)
+
+		case f := <-b.frames:
+			if f.conn != b.conn && f.conn != b.pending {
+				break // Leftovers from a closed connection
+			}
+			if f.err != nil {
+				if f.conn == b.pending {
+					log.Println("websocket: Reconnect failed:", f.err)
+					b.pending.Close()
+					b.pending = nil
+					break
+				}
+				log.Println("websocket:", f.err)
+				b.reconnectEventSub()
+				break
+			}
+
+			msgType := b.HandleMessage(f.data)
+			watchdog.Reset(b.keepalive + EventSubKeepaliveGrace)
+
+			if f.conn == b.pending && msgType == "session_welcome" {
+				log.Println("websocket: Switched to reconnect URL.")
+				b.conn.Close()
+				b.conn = b.pending
+				b.pending = nil
+			}
+			if b.reconnectURL != "" {
+				if b.pending == nil && !b.dialing {
+					b.dialing = true
+					go b.dialEventSub(b.reconnectURL, true)
+				}
+				b.reconnectURL = ""
 			}
-			//err := c.WriteMessage(websocket.TextMessage, []byte(t.String()))
-			//if err != nil {
-			//	log.Println("write:", err)
-			//	return
-			//}
+
+		case <-watchdog.C:
+			if b.dialing {
+				watchdog.Reset(EventSubWelcomeTimeout)
+				break
+			}
+			log.Println("websocket: Keepalive timed out. Reconnecting.")
+			b.reconnectEventSub()
+			watchdog.Reset(EventSubWelcomeTimeout)
+
+		case now := <-ticker.C:
+			b.MaintainUserAuthToken(now)
+
+		case <-b.shutdown:
+			alive = false
+
 		case sig := <-interrupt:
 			log.Println("websocket: Interrupt received.")
 			alive = false
 			b.GameInterrupt <- sig
-			b.shutdown <- true
 		}
 	}
 
 	log.Println("websocket: Shutting down.")
-	err = c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-	if err != nil {
-		log.Println(err)
-		return
+	if b.pending != nil {
+		b.pending.Close()
 	}
-	select {
-	case <-done:
-	case <-time.After(time.Second):
+	if b.conn != nil {
+		err := b.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		if err != nil {
+			log.Println(err)
+		}
+		b.conn.Close()
 	}
 	select {
 	case <-b.GameDone:
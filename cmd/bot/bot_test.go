@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func welcomeMessage(sessionID string, keepalive int) string {
+	return fmt.Sprintf(`{"metadata":{"message_type":"session_welcome"},"payload":{"session":{"id":%q,"status":"connected","keepalive_timeout_seconds":%d}}}`, sessionID, keepalive)
+}
+
+// Walks the bot through a session_reconnect handoff and then a keepalive
+// timeout, checking that the old connection is released each time.
+func TestEventSubReconnectAndWatchdog(t *testing.T) {
+	grace := EventSubKeepaliveGrace
+	EventSubKeepaliveGrace = 200 * time.Millisecond
+	defer func() { EventSubKeepaliveGrace = grace }()
+
+	events := make(chan string, 16)
+	upgrader := websocket.Upgrader{}
+	var connects atomic.Int32
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	wsBase := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		n := connects.Add(1)
+		events <- fmt.Sprint("connect ws ", n)
+
+		c.WriteMessage(websocket.TextMessage, []byte(welcomeMessage(fmt.Sprint("session-", n), 1)))
+		if n == 1 {
+			c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(
+				`{"metadata":{"message_type":"session_reconnect"},"payload":{"session":{"id":"session-1","status":"reconnecting","reconnect_url":%q}}}`,
+				wsBase+"/reconnect",
+			)))
+		}
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				events <- fmt.Sprint("closed ws ", n)
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/reconnect", func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		events <- "connect reconnect"
+
+		c.WriteMessage(websocket.TextMessage, []byte(welcomeMessage("session-1", 1)))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"metadata":{"message_type":"revocation"},"payload":{"subscription":{"id":"sub","status":"authorization_revoked","type":"channel.chat.message"}}}`))
+		// Then go quiet so the keepalive watchdog fires.
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				events <- "closed reconnect"
+				return
+			}
+		}
+	})
+
+	gameDone := make(chan struct{})
+	close(gameDone)
+	b := &ChatBot{
+		EventSubURL: wsBase + "/ws",
+		keepalive:   EventSubWelcomeTimeout,
+		shutdown:    make(chan bool, 1),
+		GameDone:    gameDone,
+	}
+	finished := make(chan struct{})
+	go func() {
+		b.Run()
+		close(finished)
+	}()
+
+	want := []string{
+		"connect ws 1",
+		"connect reconnect",
+		"closed ws 1",
+		"closed reconnect",
+		"connect ws 2",
+	}
+	got := make(map[string]bool)
+	timeout := time.After(10 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case e := <-events:
+			got[e] = true
+		case <-timeout:
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	for _, e := range want {
+		if !got[e] {
+			t.Fatalf("missing event %q, got %v", e, got)
+		}
+	}
+
+	b.RequestShutdown()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot did not shut down")
+	}
+}
+
+func TestHandleMessageSessionResume(t *testing.T) {
+	b := &ChatBot{shutdown: make(chan bool, 1)}
+	b.sessionID = "session-1"
+
+	msgType := b.HandleMessage([]byte(welcomeMessage("session-1", 30)))
+	if msgType != "session_welcome" {
+		t.Fatalf("message type %q, want session_welcome", msgType)
+	}
+	if b.keepalive != 30*time.Second {
+		t.Fatalf("keepalive %v, want 30s", b.keepalive)
+	}
+
+	b.HandleMessage([]byte(`{"metadata":{"message_type":"session_reconnect"},"payload":{"session":{"id":"session-1","reconnect_url":"wss://example.test/ws"}}}`))
+	if b.reconnectURL != "wss://example.test/ws" {
+		t.Fatalf("reconnect URL %q not recorded", b.reconnectURL)
+	}
+}
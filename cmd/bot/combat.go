@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How long party members have to choose an action each round.
+const TurnWait = 6 * time.Second
+
+type Action int
+
+const (
+	ActionAttack  Action = iota // Melee attack. The default
+	ActionShoot                 // Ranged attack
+	ActionUse                   // Use an item
+	ActionCast                  // Cast a spell
+	ActionFlee                  // Run into a random room
+	ActionTaunt                 // Draw the monster's attack
+	ActionPrepare               // Ready a spell
+	ActionReady                 // Ready an item
+)
+
+// Indexed by action. Each is also a combat command.
+var ActionNames = []string{"attack", "shoot", "use", "cast", "flee", "taunt", "prepare", "ready"}
+
+// What a member will do this round. Arg names the item or spell, if any.
+type Choice struct {
+	Action
+	Arg string
+}
+
+// A fight between the party and one monster, in rounds. The party chooses
+// actions until everyone has acted or the turn times out, then the party's
+// actions resolve followed by the monster's turn.
+type Combat struct {
+	Monster
+
+	Round    int
+	Choices  map[string]Choice // User ID -> this round's choice
+	Deadline time.Time
+
+	Taunter string          // User ID the monster is goaded into attacking
+	Webbed  map[string]bool // User IDs who lose their next action
+
+	MoraleChecks int  // Morale thresholds already checked
+	Fleeing      bool // The monster escapes on its next turn
+	Asleep       int  // Turns the monster will sleep through
+
+	Buffs []Buff
+}
+
+// Roll for which side acts first. An unaware side loses automatically.
+// Ties go to the party.
+func (g *GameServer) RollInitiative(partyAware bool, monsterAware bool) bool {
+	if partyAware != monsterAware {
+		return partyAware
+	}
+	return 1+g.Rand.IntN(6) >= 1+g.Rand.IntN(6)
+}
+
+// A lit party is never caught unaware.
+func (g *GameServer) StartCombat(m Monster, partyAware bool, monsterAware bool, now time.Time) {
+	partyAware = partyAware || g.Delve.Light > 0
+
+	c := &Combat{
+		Monster: m,
+		Choices: make(map[string]Choice, len(g.Party.Members)),
+		Webbed:  make(map[string]bool),
+	}
+	g.Delve.Combat = c
+
+	partyFirst := g.RollInitiative(partyAware, monsterAware)
+	m1 := "A " + m.Name + " attacks!"
+	if !monsterAware {
+		m1 = "The party catches a " + m.Name + " unaware!"
+	} else if partyFirst {
+		m1 += " The party acts first."
+	} else {
+		m1 += " The " + m.Name + " strikes first!"
+	}
+	log.Println("game:", m1)
+	g.Say(PriorityHigh, m1)
+
+	if !partyFirst {
+		g.MonsterTurn(now)
+		if g.PartyFallen() {
+			return
+		}
+	}
+	g.NextRound(now)
+}
+
+func (g *GameServer) NextRound(now time.Time) {
+	c := g.Delve.Combat
+	g.TickBuffs()
+	c.Round++
+	clear(c.Choices)
+	c.Taunter = ""
+	c.Deadline = now.Add(g.TurnWait)
+
+	g.Say(PriorityNormal, fmt.Sprintf("Round %d. %s %d/%d HP. !%s (%ds)",
+		c.Round, c.Monster.Name, c.Monster.HP, c.Monster.HPMax,
+		strings.Join(ActionNames, " !"), int(g.TurnWait.Seconds())))
+}
+
+// Members still able to act.
+func (g *GameServer) Standing() []string {
+	standing := make([]string, 0, len(g.Party.Members))
+	for _, uid := range g.Party.Members {
+		if g.Party.PlayerCharacters[uid].Vitality == Alive {
+			standing = append(standing, uid)
+		}
+	}
+	return standing
+}
+
+func (g *GameServer) ChooseAction(cmd Command, now time.Time) {
+	if g.Delve == nil || g.Delve.Combat == nil {
+		return
+	}
+	c := g.Delve.Combat
+	standing := g.Standing()
+	if !slices.Contains(standing, cmd.UserID) {
+		return
+	}
+
+	action := Action(slices.Index(ActionNames, cmd.Verb))
+	c.Choices[cmd.UserID] = Choice{Action: action, Arg: cmd.RawArgs}
+
+	if len(c.Choices) >= len(standing) {
+		g.ResolveRound(now)
+	}
+}
+
+// Resolve the party's actions, then the monster's turn.
+func (g *GameServer) ResolveRound(now time.Time) {
+	c := g.Delve.Combat
+	standing := g.Standing()
+
+	fleeing := 0
+	for _, uid := range standing {
+		choice, ok := c.Choices[uid]
+		if !ok {
+			choice = Choice{Action: ActionAttack}
+		}
+		if c.Webbed[uid] {
+			delete(c.Webbed, uid)
+			g.Say(PriorityNormal, g.Party.Name(uid)+" struggles free of the web.")
+			continue
+		}
+		if choice.Action == ActionFlee {
+			fleeing++
+			continue
+		}
+		g.ResolveAction(uid, choice, now)
+		if g.Delve == nil || g.Delve.Combat != c {
+			return // Whisked away, or fallen to their own magic
+		}
+		if c.Monster.HP <= 0 {
+			m := g.Party.Name(uid) + " slays the " + c.Monster.Name + "!"
+			log.Println("game:", m)
+			g.Say(PriorityHigh, m)
+			g.EndCombat()
+			g.Delve.Room().Monster = false
+			g.Delve.EarnXP("slaying", c.Monster.XP)
+			g.Loot(c.Monster, uid)
+			g.OpenVote(now)
+			return
+		}
+	}
+
+	g.MonsterTurn(now)
+	if g.Delve.Combat == nil || g.PartyFallen() {
+		return
+	}
+
+	if fleeing > len(standing)/2 {
+		g.Flee(now)
+		return
+	}
+	g.NextRound(now)
+}
+
+// Casting and preparing also resolve out of combat, with no Combat.
+func (g *GameServer) ResolveAction(uid string, choice Choice, now time.Time) {
+	c := g.Delve.Combat
+	pc := g.Party.PlayerCharacters[uid]
+
+	switch choice.Action {
+	case ActionTaunt:
+		c.Taunter = uid
+		g.Say(PriorityNormal, pc.Name+" taunts the "+c.Monster.Name+".")
+	case ActionUse:
+		g.Use(uid, choice.Arg, now)
+	case ActionReady:
+		g.Ready(uid, choice.Arg)
+	case ActionCast:
+		g.Cast(uid, choice.Arg, now)
+	case ActionPrepare:
+		g.Prepare(uid, choice.Arg)
+	case ActionShoot:
+		if !pc.Weapon.Ranged {
+			g.Say(PriorityNormal, pc.Name+" has no ranged weapon and charges in.")
+		}
+		g.Strike(pc, pc.Attack)
+	default:
+		// A bow is no good up close.
+		dice := pc.Attack
+		if pc.Weapon.Ranged {
+			dice = Fists
+		}
+		g.Strike(pc, dice)
+	}
+}
+
+func (g *GameServer) Strike(pc Character, dice Dice) {
+	c := g.Delve.Combat
+	damage := max(0, dice.Roll(g.Rand)-c.Monster.Defense)
+	c.Monster.HP -= damage
+	if damage == 0 {
+		g.Say(PriorityNormal, pc.Name+"'s blow glances off the "+c.Monster.Name+".")
+	} else {
+		g.Say(PriorityNormal, fmt.Sprintf("%s hits the %s for %d.", pc.Name, c.Monster.Name, damage))
+	}
+}
+
+// A monster that fled last turn escapes. Otherwise it checks morale, then
+// acts on a target chosen by its behavior.
+func (g *GameServer) MonsterTurn(now time.Time) {
+	c := g.Delve.Combat
+	targets := g.Targets()
+	if len(g.Standing()) == 0 {
+		return
+	}
+
+	if c.Asleep > 0 {
+		c.Asleep--
+		g.Say(PriorityNormal, "The "+c.Monster.Name+" snores.")
+		return
+	}
+
+	if c.Fleeing {
+		m := "The " + c.Monster.Name + " escapes!"
+		log.Println("game:", m)
+		g.Say(PriorityHigh, m)
+		g.EndCombat()
+		g.Delve.Room().Monster = false
+		g.OpenVote(now)
+		return
+	}
+
+	if g.CheckMorale(c) {
+		c.Fleeing = true
+		m := "The " + c.Monster.Name + " turns to flee! One round to stop it."
+		log.Println("game:", m)
+		g.Say(PriorityHigh, m)
+		return
+	}
+
+	b := c.Monster.Behavior
+	b.Act(g, c, g.PickTarget(c, b, targets))
+}
+
+// Ends the delve if no one is left standing. Downed goblins crawl home
+// with nothing to show for it.
+func (g *GameServer) PartyFallen() bool {
+	if len(g.Standing()) > 0 {
+		return false
+	}
+	m := "The party has fallen."
+	if c := g.Delve.Combat; c != nil {
+		m = "The party has fallen to the " + c.Monster.Name + "."
+	}
+	if len(g.Party.Members) > 0 {
+		m += " The survivors crawl home empty handed."
+	}
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+	g.EndDelve()
+	return true
+}
+
+// Run into a random neighboring room, leaving the monster behind.
+func (g *GameServer) Flee(now time.Time) {
+	exits := g.Delve.Exits()
+	dir := exits[g.Rand.IntN(len(exits))]
+	g.EndCombat()
+	g.Delve.Move(dir)
+	g.Delve.Light = max(0, g.Delve.Light-1)
+
+	m := "The party flees " + DirectionNames[dir] + "!"
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+	g.EnterRoom(now)
+}
+
+func (g *GameServer) EndCombat() {
+	g.ClearBuffs()
+	g.Delve.Combat = nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A weak monster from the vermin loot table.
+func testMonster() Monster {
+	return Monster{
+		Name:        "Giant Rat",
+		HP:          4,
+		HPMax:       4,
+		Attack:      MustParseDice("1d3"),
+		Morale:      12,
+		Behavior:    Brute{},
+		LootTableID: 1,
+	}
+}
+
+// Alice and Bob in the first room, facing a monster.
+func newTestCombat(t *testing.T, m Monster) (*GameServer, time.Time) {
+	t.Helper()
+	g, now := newTestDelve(t)
+	g.Rand = rand.New(rand.NewPCG(1, 2))
+	g.Delve.Vote = nil
+	g.StartCombat(m, true, false, now)
+	if g.Delve.Combat == nil || g.Delve.Combat.Round != 1 {
+		t.Fatal("combat did not start with the party's turn")
+	}
+	drainChat(g)
+	return g, now
+}
+
+func TestInitiative(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+
+	for range 20 {
+		if !g.RollInitiative(true, false) {
+			t.Fatal("unaware monster took the initiative")
+		}
+		if g.RollInitiative(false, true) {
+			t.Fatal("unaware party took the initiative")
+		}
+	}
+}
+
+func TestCombatRoundWaitsForEveryone(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+
+	sendCommand(t, g, "1", "Alice", "!taunt", now)
+	if g.Delve.Combat.Round != 1 {
+		t.Fatal("round resolved before everyone acted")
+	}
+	sendCommand(t, g, "2", "Bob", "!attack", now)
+	if g.Delve.Combat.Round != 2 {
+		t.Fatal("round did not resolve once everyone acted")
+	}
+
+	if chat := drainChat(g); !strings.Contains(chat, "Alice taunts") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestCombatTimeoutDefaultsToAttack(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+
+	g.Update(now.Add(g.TurnWait - time.Second))
+	if g.Delve.Combat.Round != 1 {
+		t.Fatal("turn ended early")
+	}
+	g.Update(now.Add(g.TurnWait))
+	if g.Delve.Combat.Round != 2 {
+		t.Fatal("turn did not end after the wait")
+	}
+	if g.Delve.Combat.Monster.HP >= 100 {
+		t.Fatal("idle members should attack by default")
+	}
+}
+
+func TestCombatDefenseAndVictory(t *testing.T) {
+	m := testMonster()
+	m.Defense = 100
+	g, now := newTestCombat(t, m)
+
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	sendCommand(t, g, "2", "Bob", "!attack", now)
+	if g.Delve.Combat.Monster.HP != m.HP {
+		t.Fatal("defense should absorb weak blows")
+	}
+
+	g.Delve.Combat.Monster.Defense = 0
+	g.Delve.Combat.Monster.HP = 1
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	sendCommand(t, g, "2", "Bob", "!attack", now)
+	if g.Delve.Combat != nil || g.Delve.Vote == nil {
+		t.Fatal("victory should end combat and open the vote")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "slays the Giant Rat!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestCombatFlee(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+	start := g.Delve.RoomPos
+
+	sendCommand(t, g, "1", "Alice", "!flee", now)
+	sendCommand(t, g, "2", "Bob", "!flee", now)
+	if g.Delve.Combat != nil || g.Delve.RoomPos == start {
+		t.Fatal("party should have fled into another room")
+	}
+}
+
+func TestCombatPartyFalls(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	m.Attack.Modifier = 100
+	g, now := newTestCombat(t, m)
+
+	for range 4 {
+		if g.Delve == nil {
+			break
+		}
+		g.Update(now.Add(g.TurnWait))
+		now = now.Add(g.TurnWait)
+	}
+	if g.Phase != PhaseTown {
+		t.Fatal("a fallen party should end the delve")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A chat command from a player. Transports build these from chat messages and
+// send them to the game server.
+type Command struct {
+	UserID      string
+	Login       string
+	DisplayName string
+
+	Verb    string   // Lowercased command name without the prefix
+	Args    []string // Parsed arguments in their original case
+	RawArgs string   // Everything after the verb, untouched
+
+	MessageID string
+	Badges    []string // Badge set IDs such as "broadcaster" or "moderator"
+	Timestamp time.Time
+}
+
+// Parse a line of chat into a command. Only the verb and arguments are
+// filled in; the transport supplies who sent it. Returns false if the line is
+// not a command.
+func ParseCommand(prefix byte, text string) (Command, bool) {
+	text = strings.TrimSpace(text)
+	if len(text) == 0 || text[0] != prefix {
+		return Command{}, false
+	}
+
+	verb, rest, _ := strings.Cut(text[1:], " ")
+	verb = strings.ToLower(verb)
+	if verb == "" {
+		return Command{}, false
+	}
+	rest = strings.TrimSpace(rest)
+
+	return Command{
+		Verb:    verb,
+		Args:    SplitArgs(rest),
+		RawArgs: rest,
+	}, true
+}
+
+// Name to show in chat.
+func (c Command) Name() string {
+	if c.DisplayName != "" {
+		return c.DisplayName
+	}
+	return c.Login
+}
+
+// The i-th argument or "" if there are not that many.
+func (c Command) Arg(i int) string {
+	if i < 0 || i >= len(c.Args) {
+		return ""
+	}
+	return c.Args[i]
+}
+
+func (c Command) HasBadge(setID string) bool {
+	for _, b := range c.Badges {
+		if b == setID {
+			return true
+		}
+	}
+	return false
+}
+
+func isQuote(r rune) bool {
+	return r == '"' || r == '“' || r == '”'
+}
+
+// Split arguments on whitespace. Double quotes, straight or curly as phones
+// like to type them, group words into one argument:
+//
+//	give "Potion of Grom's Blood" bob -> [give, Potion of Grom's Blood, bob]
+//
+// Apostrophes are part of words. An unclosed quote runs to the end.
+func SplitArgs(s string) []string {
+	args := make([]string, 0, 4)
+	var sb strings.Builder
+	quoted := false
+	started := false
+
+	for _, r := range s {
+		switch {
+		case isQuote(r):
+			if quoted && sb.Len() > 0 {
+				args = append(args, sb.String())
+				sb.Reset()
+				started = false
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				args = append(args, sb.String())
+				sb.Reset()
+				started = false
+			}
+		default:
+			sb.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		args = append(args, strings.TrimSpace(sb.String()))
+	}
+
+	return args
+}
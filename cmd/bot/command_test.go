@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		text string
+		ok   bool
+		verb string
+		args []string
+	}{
+		{"!", false, "", nil},
+		{"! join", false, "", nil},
+		{"hello !join", false, "", nil},
+		{"!JOIN", true, "join", []string{}},
+		{"!inspect BobTheGoblin", true, "inspect", []string{"BobTheGoblin"}},
+		{`!give "Potion of Grom's Blood" bob`, true, "give", []string{"Potion of Grom's Blood", "bob"}},
+		{"!give “Rusty Shank” Bob", true, "give", []string{"Rusty Shank", "Bob"}},
+		{`!use "Potion of`, true, "use", []string{"Potion of"}},
+		{"!drop   Grom's   Blood  ", true, "drop", []string{"Grom's", "Blood"}},
+	}
+
+	for _, c := range cases {
+		cmd, ok := ParseCommand('!', c.text)
+		if ok != c.ok {
+			t.Fatalf("%q: ok = %v, want %v", c.text, ok, c.ok)
+		}
+		if !ok {
+			continue
+		}
+		if cmd.Verb != c.verb {
+			t.Fatalf("%q: verb %q, want %q", c.text, cmd.Verb, c.verb)
+		}
+		if !slices.Equal(cmd.Args, c.args) {
+			t.Fatalf("%q: args %q, want %q", c.text, cmd.Args, c.args)
+		}
+	}
+}
+
+func TestCommandArg(t *testing.T) {
+	cmd, _ := ParseCommand('!', "!inspect Bob")
+	if cmd.Arg(0) != "Bob" || cmd.Arg(1) != "" || cmd.Arg(-1) != "" {
+		t.Fatalf("unexpected args %q", cmd.Args)
+	}
+	if cmd.RawArgs != "Bob" {
+		t.Fatalf("raw args %q, want Bob", cmd.RawArgs)
+	}
+}
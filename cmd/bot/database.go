@@ -4,31 +4,163 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type DatabaseItem struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Value       int    `json:"value"`
-	Attack      string `json:"attack"`
-	Defense     int    `json:"defense"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Value       int      `json:"value"`
+	Attack      string   `json:"attack"`
+	Defense     int      `json:"defense"`
+	Description string   `json:"description"`
+	Effects     []Effect `json:"effects"` // What using it does
+	Form        string   `json:"form"`    // Unidentified until used if set
+	Agility     int      `json:"agility"` // Added to the wearer's Agility
+	Ranged      bool     `json:"ranged"`  // Weapons only. Shoots instead of stabs
+}
+
+type DatabaseMonster struct {
+	Name        string  `json:"name"`
+	HP          int     `json:"hp"`
+	Defense     int     `json:"defense"`
+	Attack      string  `json:"attack"`
+	Morale      int     `json:"morale"`
+	Awareness   float64 `json:"awareness"`
+	LevelMin    int     `json:"level_min"`
+	LevelMax    int     `json:"level_max"`
+	XP          int     `json:"xp"`
+	Loot        string  `json:"loot"`
+	Behavior    string  `json:"behavior"`
+	Description string  `json:"description"`
+}
+
+type DatabaseSpell struct {
+	Name        string   `json:"name"`
+	Will        int      `json:"will"`
+	Level       int      `json:"level"`
+	Starting    bool     `json:"starting"` // Every new goblin knows it
+	Description string   `json:"description"`
+	Effects     []Effect `json:"effects"`
+}
+
+type DatabaseTrap struct {
+	Name        string   `json:"name"`
+	LevelMin    int      `json:"level_min"`
+	LevelMax    int      `json:"level_max"`
+	Difficulty  int      `json:"difficulty"` // Agility penalty to dodge it
+	Description string   `json:"description"`
+	Effects     []Effect `json:"effects"`
+}
+
+type DatabaseLootTable struct {
+	Name    string `json:"name"`
+	Shinies string `json:"shinies"`
+	Drops   []struct {
+		Item   string  `json:"item"`
+		Chance float64 `json:"chance"`
+	} `json:"drops"`
 }
 
 // Enum for queries
-const QueryCount int = 2
+const QueryCount int = 20
 const (
 	// Params:  cmd string
 	// Returns: name string, type string
 	QueryCommand int = iota
 
-	// Params:  twitch_id int
-	// Returns: id int
+	// Params:  twitch_id string
+	// Returns: id int of the living character
 	QueryUser
+
+	// Params:
+	// Returns: command string (many rows)
+	QueryCommandList
+
+	// Params:
+	// Returns: name string (many rows)
+	QueryItemNames
+
+	// Params:  twitch_id string
+	// Returns: id int, name string, level int, experience int, sign string,
+	//          might int, agility int, will int, hp int, weapon_id int,
+	//          armor_id int
+	QueryCharacter
+
+	// Params:  level int
+	// Returns: id int (many rows)
+	QueryMonsterList
+
+	// Params:  id int
+	// Returns: name string, hp int, defense int, attack string, morale int,
+	//          awareness float, xp int, loot_table_id int, behavior string
+	QueryMonster
+
+	// Params:  loot_table_id int
+	// Returns: shinies string
+	QueryLootTable
+
+	// Params:  loot_table_id int
+	// Returns: item_id int, name string, appearance string, chance float
+	//          (many rows)
+	QueryLootDrops
+
+	// Params:  character_id int
+	// Returns: spell_id int (many rows)
+	QueryCharacterSpells
+
+	// Params:  id int
+	// Returns: name string, will int, level int, description string
+	QuerySpell
+
+	// Params:  spell_id int
+	// Returns: kind string, target string, dice string, stat string,
+	//          rounds int (many rows)
+	QuerySpellEffects
+
+	// Params:  id int
+	// Returns: name string, type string, value int, description string,
+	//          appearance string, attack string, defense int, agility int,
+	//          ranged bool
+	QueryItem
+
+	// Params:  item_id int
+	// Returns: kind string, target string, dice string, stat string,
+	//          rounds int (many rows)
+	QueryItemEffects
+
+	// Params:  owner_type string, owner_id int
+	// Returns: item_id int, count int (many rows, in slot order)
+	QueryInventory
+
+	// Params:  level int
+	// Returns: id int (many rows)
+	QueryTrapList
+
+	// Params:  id int
+	// Returns: name string, difficulty int, description string
+	QueryTrap
+
+	// Params:  trap_id int
+	// Returns: kind string, target string, dice string, stat string,
+	//          rounds int (many rows)
+	QueryTrapEffects
+
+	// Params:  character_id int
+	// Returns: item_id int of each identified item (many rows)
+	QueryKnownItems
+
+	// Params:  id int
+	// Returns: shinies int
+	QueryShinies
 )
 
 func InitQuery(db *sql.DB) ([]*sql.Stmt, error) {
@@ -47,7 +179,174 @@ func InitQuery(db *sql.DB) ([]*sql.Stmt, error) {
 	}
 
 	query[QueryUser], err = db.Prepare(`
-	SELECT twitch_id FROM User WHERE twitch_id = ? LIMIT 1
+	SELECT Character.id
+	FROM Character
+	JOIN User ON Character.user_id = User.id
+	WHERE User.twitch_id = ? AND Character.alive = 1
+	LIMIT 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryCommandList], err = db.Prepare(`
+	SELECT command FROM Command ORDER BY command
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryItemNames], err = db.Prepare(`
+	SELECT Item.name
+	FROM Item
+	JOIN ItemType ON Item.type_id = ItemType.id
+	WHERE ItemType.type != 'empty'
+	ORDER BY Item.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryCharacter], err = db.Prepare(`
+	SELECT
+		Character.id, Character.name, Character.level,
+		Character.experience, Character.sign,
+		Character.might, Character.agility, Character.will, Character.hp,
+		Character.weapon_id, Character.armor_id
+	FROM Character
+	JOIN User ON Character.user_id = User.id
+	WHERE User.twitch_id = ? AND Character.alive = 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryMonsterList], err = db.Prepare(`
+	SELECT id FROM Monster WHERE level_min <= ?1 AND ?1 <= level_max ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryMonster], err = db.Prepare(`
+	SELECT name, hp, defense, attack, morale, awareness, xp, loot_table_id, behavior
+	FROM Monster
+	WHERE id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryLootTable], err = db.Prepare(`
+	SELECT shinies FROM LootTable WHERE id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryLootDrops], err = db.Prepare(`
+	SELECT LootDrop.item_id, Item.name, Item.appearance, LootDrop.chance
+	FROM LootDrop
+	JOIN Item ON LootDrop.item_id = Item.id
+	WHERE LootDrop.loot_table_id = ?
+	ORDER BY LootDrop.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryCharacterSpells], err = db.Prepare(`
+	SELECT spell_id FROM CharacterSpell WHERE character_id = ? ORDER BY spell_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QuerySpell], err = db.Prepare(`
+	SELECT name, will, level, description FROM Spell WHERE id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QuerySpellEffects], err = db.Prepare(`
+	SELECT Effect.kind, Effect.target, Effect.dice, Effect.stat, Effect.rounds
+	FROM SpellEffect
+	JOIN Effect ON SpellEffect.effect_id = Effect.id
+	WHERE SpellEffect.spell_id = ?
+	ORDER BY Effect.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryItem], err = db.Prepare(`
+	SELECT
+		Item.name, ItemType.type, Item.value, Item.description, Item.appearance,
+		Item.attack, Item.defense, Item.agility, Item.ranged
+	FROM Item
+	JOIN ItemType ON Item.type_id = ItemType.id
+	WHERE Item.id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryItemEffects], err = db.Prepare(`
+	SELECT Effect.kind, Effect.target, Effect.dice, Effect.stat, Effect.rounds
+	FROM ItemEffect
+	JOIN Effect ON ItemEffect.effect_id = Effect.id
+	WHERE ItemEffect.item_id = ?
+	ORDER BY Effect.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryInventory], err = db.Prepare(`
+	SELECT item_id, count
+	FROM ItemInstance
+	WHERE owner_type = ? AND owner_id = ? AND state = ''
+	ORDER BY slot
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryTrapList], err = db.Prepare(`
+	SELECT id FROM Trap WHERE level_min <= ?1 AND ?1 <= level_max ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryTrap], err = db.Prepare(`
+	SELECT name, difficulty, description FROM Trap WHERE id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryTrapEffects], err = db.Prepare(`
+	SELECT Effect.kind, Effect.target, Effect.dice, Effect.stat, Effect.rounds
+	FROM TrapEffect
+	JOIN Effect ON TrapEffect.effect_id = Effect.id
+	WHERE TrapEffect.trap_id = ?
+	ORDER BY Effect.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryKnownItems], err = db.Prepare(`
+	SELECT item_id FROM ItemKnowledge WHERE character_id = ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	query[QueryShinies], err = db.Prepare(`
+	SELECT shinies FROM Character WHERE id = ?
 	`)
 	if err != nil {
 		return nil, err
@@ -69,43 +368,1820 @@ func CloseQuery(query []*sql.Stmt) {
 	}
 }
 
-// TODO: Abstract effect system
-func CreateItemTable(db *sql.DB) error {
-	defaultItemTypes := map[string]int{
-		"empty":      1,
-		"armor":      2,
-		"weapon":     3,
-		"consumable": 4,
-	}
-	defaultItems := []DatabaseItem{}
-	data, err := os.ReadFile(GetPathPrefix() + "data/default_items.json")
+// Everything random about a world that must stay the same between restarts.
+func CreateWorldTable(db *sql.DB, seed uint64) error {
+	_, err := db.Exec(`
+	CREATE TABLE World (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		seed INTEGER NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO World (id, seed) VALUES (1, ?)", int64(seed))
+	return err
+}
+
+// Shuffle the appearances of each form with the world seed, so a murky green
+// potion is the same thing all game long but different in every world.
+// Returns appearances by item name.
+func ShuffleAppearances(seed uint64, items []DatabaseItem, pools map[string][]string) (map[string]string, error) {
+	forms := make([]string, 0, len(pools))
+	for form := range pools {
+		forms = append(forms, form)
+	}
+	slices.Sort(forms)
+
+	rng := rand.New(rand.NewPCG(seed, SEEDCONST^seed))
+	perms := make(map[string][]int, len(pools))
+	for _, form := range forms {
+		perms[form] = rng.Perm(len(pools[form]))
+	}
+
+	appearances := make(map[string]string)
+	used := make(map[string]int, len(pools))
+	for _, item := range items {
+		if item.Form == "" {
+			continue
+		}
+		pool, ok := pools[item.Form]
+		if !ok {
+			return nil, fmt.Errorf("item %q: unknown form %q", item.Name, item.Form)
+		}
+		i := used[item.Form]
+		if i >= len(pool) {
+			return nil, fmt.Errorf("item %q: out of %s appearances", item.Name, item.Form)
+		}
+		appearances[item.Name] = pool[perms[item.Form][i]]
+		used[item.Form]++
+	}
+	return appearances, nil
+}
+
+// Spells, items and traps all share the Effect table.
+func CreateEffectTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE Effect (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL CHECK (
+			kind IN ('damage', 'heal', 'buff', 'sleep', 'light', 'teleport', 'identify')
+		),
+		target TEXT NOT NULL CHECK (target IN ('self', 'ally', 'monster', 'party')),
+		dice TEXT NOT NULL DEFAULT '',
+		stat TEXT NOT NULL DEFAULT '',
+		rounds INTEGER NOT NULL DEFAULT 0 CHECK (rounds >= 0)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Prepare within a transaction for AttachEffects.
+const InsertEffect = "INSERT INTO Effect (kind, target, dice, stat, rounds) VALUES (?, ?, ?, ?, ?)"
+
+// Insert effects and link each to their owner with link, which takes the
+// owner and effect IDs.
+func AttachEffects(insert *sql.Stmt, link *sql.Stmt, ownerID int64, effects []Effect) error {
+	for _, e := range effects {
+		res, err := insert.Exec(e.Kind, e.Target, e.Dice, e.Stat, e.Rounds)
+		if err != nil {
+			return err
+		}
+		effectID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		_, err = link.Exec(ownerID, effectID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trap <- TrapEffect -> Effect. Requires the Effect table.
+func CreateTrapTables(db *sql.DB) error {
+	traps := []DatabaseTrap{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/traps.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &traps)
+	if err != nil {
+		return err
+	}
+	for _, t := range traps {
+		if len(t.Effects) == 0 {
+			return fmt.Errorf("trap %q: no effects", t.Name)
+		}
+		for _, e := range t.Effects {
+			if err = e.Validate(); err != nil {
+				return fmt.Errorf("trap %q: %w", t.Name, err)
+			}
+		}
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE Trap (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		level_min INTEGER NOT NULL,
+		level_max INTEGER NOT NULL CHECK (level_min <= level_max),
+		difficulty INTEGER NOT NULL,
+		description TEXT NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE TrapEffect (
+		trap_id INTEGER NOT NULL REFERENCES Trap (id),
+		effect_id INTEGER NOT NULL REFERENCES Effect (id),
+		PRIMARY KEY (trap_id, effect_id)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	trapStmt, err := tx.Prepare(`
+		INSERT INTO Trap (
+		name,
+		level_min,
+		level_max,
+		difficulty,
+		description
+		) VALUES (?, ?, ?, ?, ?)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer trapStmt.Close()
+
+	effectStmt, err := tx.Prepare(InsertEffect)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer effectStmt.Close()
+
+	trapEffectStmt, err := tx.Prepare("INSERT INTO TrapEffect (trap_id, effect_id) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer trapEffectStmt.Close()
+
+	for _, t := range traps {
+		res, err := trapStmt.Exec(t.Name, t.LevelMin, t.LevelMax, t.Difficulty, t.Description)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		trapID, err := res.LastInsertId()
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		err = AttachEffects(effectStmt, trapEffectStmt, trapID, t.Effects)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Kinds of item.
+var DefaultItemTypes = map[string]int{
+	"empty":      1,
+	"armor":      2,
+	"weapon":     3,
+	"consumable": 4,
+}
+
+// Read and check the default items and the appearance pools magic items are
+// disguised with.
+func LoadDefaultItems() ([]DatabaseItem, map[string][]string, error) {
+	defaultItems := []DatabaseItem{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/default_items.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = json.Unmarshal(data, &defaultItems)
+	if err != nil {
+		return nil, nil, err
+	}
+	pools := map[string][]string{}
+	data, err = os.ReadFile(GetPathPrefix() + "data/appearances.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = json.Unmarshal(data, &pools)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, item := range defaultItems {
+		if _, ok := DefaultItemTypes[item.Type]; !ok {
+			return nil, nil, fmt.Errorf("item %q: unknown type %q", item.Name, item.Type)
+		}
+		for _, e := range item.Effects {
+			if err = e.Validate(); err != nil {
+				return nil, nil, fmt.Errorf("item %q: %w", item.Name, err)
+			}
+		}
+		if item.Ranged && item.Type != "weapon" {
+			return nil, nil, fmt.Errorf("item %q: only weapons are ranged", item.Name)
+		}
+		if item.Attack == "" {
+			continue
+		}
+		if _, err = ParseDice(item.Attack); err != nil {
+			return nil, nil, fmt.Errorf("item %q: %w", item.Name, err)
+		}
+	}
+	return defaultItems, pools, nil
+}
+
+const createItemEffectTable = `
+	CREATE TABLE ItemEffect (
+		item_id INTEGER NOT NULL REFERENCES Item (id),
+		effect_id INTEGER NOT NULL REFERENCES Effect (id),
+		PRIMARY KEY (item_id, effect_id)
+	) STRICT;
+	`
+
+// Item <- ItemEffect -> Effect. Requires the Effect table. Magic items look
+// different in every world.
+func CreateItemTable(db *sql.DB, seed uint64) error {
+	defaultItems, pools, err := LoadDefaultItems()
+	if err != nil {
+		return err
+	}
+	appearances, err := ShuffleAppearances(seed, defaultItems, pools)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE ItemType (
+		id INTEGER PRIMARY KEY,
+		type TEXT UNIQUE NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE Item (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		type_id INTEGER NOT NULL REFERENCES ItemType (id),
+		value INTEGER NOT NULL,
+		attack TEXT NOT NULL,
+		defense INTEGER NOT NULL,
+		description TEXT NOT NULL,
+		appearance TEXT NOT NULL DEFAULT '',
+		agility INTEGER NOT NULL DEFAULT 0,
+		ranged INTEGER NOT NULL DEFAULT 0 CHECK (ranged IN (0, 1))
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(createItemEffectTable)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	itemTypeStmt, err := tx.Prepare("INSERT INTO ItemType (id, type) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer itemTypeStmt.Close()
+
+	itemStmt, err := tx.Prepare(`
+		INSERT INTO Item (
+		name,
+		type_id,
+		value,
+		attack,
+		defense,
+		description,
+		appearance,
+		agility,
+		ranged
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer itemStmt.Close()
+
+	effectStmt, err := tx.Prepare(InsertEffect)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer effectStmt.Close()
+
+	itemEffectStmt, err := tx.Prepare("INSERT INTO ItemEffect (item_id, effect_id) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer itemEffectStmt.Close()
+
+	for itemType, id := range DefaultItemTypes {
+		_, err = itemTypeStmt.Exec(id, itemType)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	for _, item := range defaultItems {
+		res, err := itemStmt.Exec(
+			item.Name, DefaultItemTypes[item.Type], item.Value,
+			item.Attack, item.Defense, item.Description, appearances[item.Name],
+			item.Agility, item.Ranged,
+		)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		itemID, err := res.LastInsertId()
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		err = AttachEffects(effectStmt, itemEffectStmt, itemID, item.Effects)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LootTable <- LootDrop, LootTable <- Monster. Requires the Item table.
+func CreateMonsterTables(db *sql.DB) error {
+	lootTables := []DatabaseLootTable{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/loot_tables.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &lootTables)
+	if err != nil {
+		return err
+	}
+	monsters := []DatabaseMonster{}
+	data, err = os.ReadFile(GetPathPrefix() + "data/monsters.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &monsters)
+	if err != nil {
+		return err
+	}
+
+	lootTableIDs := make(map[string]int, len(lootTables))
+	for i, lt := range lootTables {
+		if _, err = ParseDice(lt.Shinies); err != nil {
+			return fmt.Errorf("loot table %q: %w", lt.Name, err)
+		}
+		lootTableIDs[lt.Name] = i + 1
+	}
+	for _, m := range monsters {
+		if _, err = ParseDice(m.Attack); err != nil {
+			return fmt.Errorf("monster %q: %w", m.Name, err)
+		}
+		if _, ok := lootTableIDs[m.Loot]; !ok {
+			return fmt.Errorf("monster %q: unknown loot table %q", m.Name, m.Loot)
+		}
+		if _, ok := Behaviors[m.Behavior]; !ok {
+			return fmt.Errorf("monster %q: unknown behavior %q", m.Name, m.Behavior)
+		}
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE LootTable (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		shinies TEXT NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE LootDrop (
+		id INTEGER PRIMARY KEY,
+		loot_table_id INTEGER NOT NULL REFERENCES LootTable (id),
+		item_id INTEGER NOT NULL REFERENCES Item (id),
+		chance REAL NOT NULL CHECK (chance BETWEEN 0 AND 1)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE Monster (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		hp INTEGER NOT NULL CHECK (hp > 0),
+		defense INTEGER NOT NULL,
+		attack TEXT NOT NULL,
+		morale INTEGER NOT NULL,
+		awareness REAL NOT NULL CHECK (awareness BETWEEN 0 AND 1),
+		level_min INTEGER NOT NULL,
+		level_max INTEGER NOT NULL CHECK (level_min <= level_max),
+		xp INTEGER NOT NULL,
+		loot_table_id INTEGER NOT NULL REFERENCES LootTable (id),
+		behavior TEXT NOT NULL,
+		description TEXT NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	lootTableStmt, err := tx.Prepare("INSERT INTO LootTable (id, name, shinies) VALUES (?, ?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer lootTableStmt.Close()
+
+	lootDropStmt, err := tx.Prepare(`
+		INSERT INTO LootDrop (loot_table_id, item_id, chance)
+		SELECT ?, id, ? FROM Item WHERE name = ?
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer lootDropStmt.Close()
+
+	monsterStmt, err := tx.Prepare(`
+		INSERT INTO Monster (
+		name,
+		hp,
+		defense,
+		attack,
+		morale,
+		awareness,
+		level_min,
+		level_max,
+		xp,
+		loot_table_id,
+		behavior,
+		description
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer monsterStmt.Close()
+
+	for _, lt := range lootTables {
+		id := lootTableIDs[lt.Name]
+		_, err = lootTableStmt.Exec(id, lt.Name, lt.Shinies)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		for _, drop := range lt.Drops {
+			res, err := lootDropStmt.Exec(id, drop.Chance, drop.Item)
+			if err != nil {
+				return errors.Join(err, tx.Rollback())
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				err = fmt.Errorf("loot table %q: unknown item %q", lt.Name, drop.Item)
+				return errors.Join(err, tx.Rollback())
+			}
+		}
+	}
+
+	for _, m := range monsters {
+		_, err = monsterStmt.Exec(
+			m.Name, m.HP, m.Defense, m.Attack, m.Morale, m.Awareness,
+			m.LevelMin, m.LevelMax, m.XP, lootTableIDs[m.Loot], m.Behavior, m.Description,
+		)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Spell <- SpellEffect -> Effect, Spell <- CharacterSpell. Requires the
+// Effect and Character tables.
+func CreateSpellTables(db *sql.DB) error {
+	spells := []DatabaseSpell{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/spells.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &spells)
+	if err != nil {
+		return err
+	}
+	for _, s := range spells {
+		if len(s.Effects) == 0 {
+			return fmt.Errorf("spell %q: no effects", s.Name)
+		}
+		for _, e := range s.Effects {
+			if err = e.Validate(); err != nil {
+				return fmt.Errorf("spell %q: %w", s.Name, err)
+			}
+		}
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE Spell (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		will INTEGER NOT NULL CHECK (will >= 0),
+		level INTEGER NOT NULL CHECK (level > 0),
+		starting INTEGER NOT NULL CHECK (starting IN (0, 1)),
+		description TEXT NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE SpellEffect (
+		spell_id INTEGER NOT NULL REFERENCES Spell (id),
+		effect_id INTEGER NOT NULL REFERENCES Effect (id),
+		PRIMARY KEY (spell_id, effect_id)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE CharacterSpell (
+		character_id INTEGER NOT NULL REFERENCES Character (id) ON DELETE CASCADE,
+		spell_id INTEGER NOT NULL REFERENCES Spell (id),
+		PRIMARY KEY (character_id, spell_id)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	spellStmt, err := tx.Prepare(`
+		INSERT INTO Spell (
+		name,
+		will,
+		level,
+		starting,
+		description
+		) VALUES (?, ?, ?, ?, ?)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer spellStmt.Close()
+
+	effectStmt, err := tx.Prepare(InsertEffect)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer effectStmt.Close()
+
+	spellEffectStmt, err := tx.Prepare("INSERT INTO SpellEffect (spell_id, effect_id) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer spellEffectStmt.Close()
+
+	for _, s := range spells {
+		res, err := spellStmt.Exec(s.Name, s.Will, s.Level, s.Starting, s.Description)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		spellID, err := res.LastInsertId()
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		err = AttachEffects(effectStmt, spellEffectStmt, spellID, s.Effects)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// User <- Character
+func CreateUserTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE User (
+		id INTEGER PRIMARY KEY,
+		twitch_id TEXT UNIQUE NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Spells a character knows are kept in CharacterSpell.
+func CreateCharacterTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE Character (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+
+		user_id INTEGER NOT NULL REFERENCES User (id) ON DELETE CASCADE,
+		armor_id INTEGER NOT NULL REFERENCES Item (id),
+		weapon_id INTEGER NOT NULL REFERENCES Item (id),
+
+		level INTEGER NOT NULL,
+		experience INTEGER NOT NULL,
+		shinies INTEGER NOT NULL,
+		sign TEXT NOT NULL DEFAULT '',
+
+		might INTEGER NOT NULL, 
+		agility INTEGER NOT NULL, 
+		will INTEGER NOT NULL ,
+
+		hp INTEGER NOT NULL,
+
+		alive INTEGER NOT NULL DEFAULT 1 CHECK (alive IN (0, 1))
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Which magic items each character has identified.
+func CreateItemKnowledgeTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE ItemKnowledge (
+		character_id INTEGER NOT NULL REFERENCES Character (id) ON DELETE CASCADE,
+		item_id INTEGER NOT NULL REFERENCES Item (id),
+		PRIMARY KEY (character_id, item_id)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Kinds of command. Town commands only work outside the dungeon.
+var DefaultCommandTypes = map[string]int{
+	"admin":   1,
+	"global":  2,
+	"combat":  3,
+	"explore": 4,
+	"town":    5,
+}
+
+// Every command a player can give, by type.
+var DefaultCommands = []struct {
+	Command string
+	Type    string
+}{
+	{"inspect", "global"},
+	{"inventory", "global"},
+	{"give", "global"},
+	{"equip", "global"},
+	{"join", "global"},
+	{"leave", "global"},
+	{"begin", "global"},
+	{"north", "explore"},
+	{"east", "explore"},
+	{"south", "explore"},
+	{"west", "explore"},
+	{"down", "explore"},
+	{"up", "explore"},
+	{"home", "explore"},
+	{"rest", "explore"},
+	{"sneak", "explore"},
+	{"steal", "explore"},
+	{"search", "explore"},
+	{"grab", "explore"},
+	{"drop", "explore"},
+	{"shop", "town"},
+	{"buy", "town"},
+	{"sell", "town"},
+	{"dice", "town"},
+	{"lottery", "town"},
+	{"attack", "combat"},
+	{"shoot", "combat"},
+	{"use", "combat"},
+	{"ready", "combat"},
+	{"cast", "combat"},
+	{"prepare", "combat"},
+	{"flee", "combat"},
+	{"taunt", "combat"},
+}
+
+func CreateCommandTables(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE CommandType (
+		id INTEGER PRIMARY KEY,
+		type TEXT UNIQUE NOT NULL
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	CREATE TABLE Command (
+		id INTEGER PRIMARY KEY,
+		command TEXT UNIQUE NOT NULL,
+		type_id INTEGER NOT NULL REFERENCES CommandType (id)
+	) STRICT;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return SyncCommands(db)
+}
+
+// Add any default commands the database does not have yet. Commands are
+// filled in on every start, so ones added since the database was made work.
+func SyncCommands(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	cmdTypeStmt, err := tx.Prepare("INSERT OR IGNORE INTO CommandType (id, type) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer cmdTypeStmt.Close()
+
+	cmdStmt, err := tx.Prepare("INSERT OR IGNORE INTO Command (command, type_id) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer cmdStmt.Close()
+
+	for cmdType, id := range DefaultCommandTypes {
+		_, err = cmdTypeStmt.Exec(id, cmdType)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	for _, cmd := range DefaultCommands {
+		_, err = cmdStmt.Exec(cmd.Command, DefaultCommandTypes[cmd.Type])
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Every goblin starts out with these.
+const (
+	StartingArmor  = "Snotty Rags"
+	StartingWeapon = "Rusty Shank"
+)
+
+// Create a goblin with a random birth sign and stats.
+func CreateCharacter(db *sql.DB, r *rand.Rand, twitch_id string, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// A user whose goblin died keeps their User row and gets a new goblin.
+	userStmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO User (
+		twitch_id
+		) VALUES (?)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer userStmt.Close()
+
+	charStmt, err := tx.Prepare(`
+		INSERT INTO Character (
+		name,
+		user_id,
+		armor_id,
+		weapon_id,
+		level,
+		experience,
+		shinies,
+		sign,
+		might,
+		agility,
+		will,
+		hp
+		) VALUES (
+		?,
+		(SELECT id FROM User WHERE twitch_id = ?),
+		(SELECT id FROM Item WHERE name = ?),
+		(SELECT id FROM Item WHERE name = ?),
+		?, ?, ?, ?, ?, ?, ?, ?
+		)
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer charStmt.Close()
+
+	spellStmt, err := tx.Prepare(`
+		INSERT INTO CharacterSpell (character_id, spell_id)
+		SELECT ?, id FROM Spell WHERE starting = 1
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer spellStmt.Close()
+
+	_, err = userStmt.Exec(twitch_id)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	sign, stats, hp := RollCharacter(r)
+	res, err := charStmt.Exec(
+		name, twitch_id, StartingArmor, StartingWeapon,
+		1, 0, 0, sign.Name, stats[0], stats[1], stats[2], hp,
+	)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	charID, err := res.LastInsertId()
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	_, err = spellStmt.Exec(charID)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unequipped items a goblin can carry.
+const CarryLimit = 5
+
+var (
+	ErrNoItem    = errors.New("no such item")
+	ErrCarryFull = errors.New("cannot carry any more")
+	ErrTooPoor   = errors.New("not enough shinies")
+)
+
+// Whoever holds an item instance.
+type Owner struct {
+	Type string // OwnerCharacter, OwnerRoom or OwnerShop
+	ID   int64
+}
+
+const (
+	OwnerCharacter = "character"
+	OwnerRoom      = "room"
+	OwnerShop      = "shop"
+)
+
+func CharacterOwner(character_id int) Owner {
+	return Owner{Type: OwnerCharacter, ID: int64(character_id)}
+}
+
+// Per-instance states. Only plain items count against the carry limit.
+const (
+	StateNone = ""
+)
+
+const createItemInstanceTable = `
+	CREATE TABLE ItemInstance (
+		id INTEGER PRIMARY KEY,
+		item_id INTEGER NOT NULL REFERENCES Item (id),
+		owner_type TEXT NOT NULL CHECK (owner_type IN ('character', 'room', 'shop')),
+		owner_id INTEGER NOT NULL,
+		slot INTEGER NOT NULL CHECK (slot > 0),
+		count INTEGER NOT NULL DEFAULT 1 CHECK (count > 0),
+		state TEXT NOT NULL DEFAULT '',
+		UNIQUE (owner_type, owner_id, slot)
+	) STRICT;
+	CREATE UNIQUE INDEX ItemInstanceStack ON ItemInstance (owner_type, owner_id, item_id) WHERE state = '';
+	`
+
+// Items held by characters, lying in rooms or for sale in the shop.
+func CreateItemInstanceTable(db *sql.DB) error {
+	_, err := db.Exec(createItemInstanceTable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Plain items a character is carrying.
+func CarriedCount(tx *sql.Tx, character_id int) (int, error) {
+	var n int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(count), 0) FROM ItemInstance
+		WHERE owner_type = 'character' AND owner_id = ? AND state = ''
+		`, character_id).Scan(&n)
+	return n, err
+}
+
+// Add to the owner's stack of the item, or start one in the first free slot.
+func AddItem(tx *sql.Tx, owner Owner, item_id int, count int) error {
+	res, err := tx.Exec(`
+		UPDATE ItemInstance SET count = count + ?
+		WHERE owner_type = ? AND owner_id = ? AND item_id = ? AND state = ''
+		`, count, owner.Type, owner.ID, item_id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ItemInstance (item_id, owner_type, owner_id, slot, count)
+		SELECT ?1, ?2, ?3, COALESCE(MIN(slot + 1), 1), ?4
+		FROM (SELECT 0 AS slot UNION ALL SELECT slot FROM ItemInstance WHERE owner_type = ?2 AND owner_id = ?3)
+		WHERE slot + 1 NOT IN (SELECT slot FROM ItemInstance WHERE owner_type = ?2 AND owner_id = ?3)
+		`, item_id, owner.Type, owner.ID, count)
+	return err
+}
+
+// Take count of the item from the owner's stack. Returns ErrNoItem if they
+// have too few.
+func RemoveItem(tx *sql.Tx, owner Owner, item_id int, count int) error {
+	res, err := tx.Exec(`
+		UPDATE ItemInstance SET count = count - ?1
+		WHERE owner_type = ?2 AND owner_id = ?3 AND item_id = ?4 AND state = '' AND count > ?1
+		`, count, owner.Type, owner.ID, item_id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	res, err = tx.Exec(`
+		DELETE FROM ItemInstance
+		WHERE owner_type = ? AND owner_id = ? AND item_id = ? AND state = '' AND count = ?
+		`, owner.Type, owner.ID, item_id, count)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoItem
+	}
+	return nil
+}
+
+// Make room for count more items if the owner is a character.
+func checkCarry(tx *sql.Tx, owner Owner, count int) error {
+	if owner.Type != OwnerCharacter {
+		return nil
+	}
+	carried, err := CarriedCount(tx, int(owner.ID))
+	if err != nil {
+		return err
+	}
+	if carried+count > CarryLimit {
+		return ErrCarryFull
+	}
+	return nil
+}
+
+// Move one of an item between owners in one transaction. Returns ErrNoItem
+// or ErrCarryFull if it cannot be done.
+func TransferItem(db *sql.DB, from Owner, to Owner, item_id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = RemoveItem(tx, from, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = checkCarry(tx, to, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = AddItem(tx, to, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Put a new item in an owner's hands. Returns ErrCarryFull if a character
+// has no room.
+func CreateItem(db *sql.DB, to Owner, item_id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = checkCarry(tx, to, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = AddItem(tx, to, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Give a character a new item. Returns false if they have no room.
+func GiveItem(db *sql.DB, character_id int, item_id int) (bool, error) {
+	err := CreateItem(db, CharacterOwner(character_id), item_id)
+	if errors.Is(err, ErrCarryFull) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Use up one of an item. Returns false if the character does not have it.
+func TakeItem(db *sql.DB, character_id int, item_id int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	err = RemoveItem(tx, CharacterOwner(character_id), item_id, 1)
+	if errors.Is(err, ErrNoItem) {
+		return false, tx.Rollback()
+	} else if err != nil {
+		return false, errors.Join(err, tx.Rollback())
+	}
+
+	return true, tx.Commit()
+}
+
+// The placeholder item in an empty equipment slot.
+const EmptyItem = 1
+
+// Equipment slots by the ItemType that goes in them. Values are Character
+// columns.
+var EquipSlots = map[string]string{
+	"weapon": "weapon_id",
+	"armor":  "armor_id",
+}
+
+// Swap a carried item into its equipment slot, putting what was there in
+// the bag. Returns ErrNoItem if the character does not carry it.
+func EquipItem(db *sql.DB, character_id int, item_id int, slot string) error {
+	column, ok := EquipSlots[slot]
+	if !ok {
+		return fmt.Errorf("equip: no %q slot", slot)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	owner := CharacterOwner(character_id)
+	err = RemoveItem(tx, owner, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	var old int
+	err = tx.QueryRow("SELECT "+column+" FROM Character WHERE id = ?", character_id).Scan(&old)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if old != EmptyItem {
+		err = AddItem(tx, owner, old, 1)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+	_, err = tx.Exec("UPDATE Character SET "+column+" = ? WHERE id = ?", item_id, character_id)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Put whatever is in an equipment slot in the bag. Returns ErrNoItem if the
+// slot is empty or ErrCarryFull if there is no room.
+func UnequipItem(db *sql.DB, character_id int, slot string) error {
+	column, ok := EquipSlots[slot]
+	if !ok {
+		return fmt.Errorf("unequip: no %q slot", slot)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var old int
+	err = tx.QueryRow("SELECT "+column+" FROM Character WHERE id = ?", character_id).Scan(&old)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if old == EmptyItem {
+		return errors.Join(ErrNoItem, tx.Rollback())
+	}
+	owner := CharacterOwner(character_id)
+	err = checkCarry(tx, owner, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = AddItem(tx, owner, old, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("UPDATE Character SET "+column+" = ? WHERE id = ?", EmptyItem, character_id)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Items on the shelf each day, and how many of each at most.
+const ShopStockSize = 4
+
+var ShopCountDice = MustParseDice("1d3")
+
+// Days the shop has been stocked, so a restart does not restock it.
+const createShopDayTable = `
+	CREATE TABLE ShopDay (
+		day INTEGER PRIMARY KEY
+	) STRICT;
+	`
+
+func CreateShopTable(db *sql.DB) error {
+	_, err := db.Exec(createShopDayTable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Put out the day's stock unless it is already out. The stock is picked
+// with the world seed and the day, so it is the same every time for a world
+// and changes daily. Yesterday's leftovers are cleared away.
+func StockShop(db *sql.DB, day int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("INSERT OR IGNORE INTO ShopDay (day) VALUES (?)", day)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return tx.Commit()
+	}
+
+	_, err = tx.Exec("DELETE FROM ShopDay WHERE day != ?", day)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("DELETE FROM ItemInstance WHERE owner_type = 'shop' AND owner_id != ?", day)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	var seed int64
+	err = tx.QueryRow("SELECT seed FROM World WHERE id = 1").Scan(&seed)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	rows, err := tx.Query(`
+		SELECT Item.id
+		FROM Item
+		JOIN ItemType ON Item.type_id = ItemType.id
+		WHERE ItemType.type != 'empty' AND Item.value > 0
+		ORDER BY Item.id
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	items := make([]int, 0, 16)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return errors.Join(err, tx.Rollback())
+		}
+		items = append(items, id)
+	}
+	rows.Close()
+
+	rng := rand.New(rand.NewPCG(uint64(seed), uint64(day)^SEEDCONST))
+	owner := Owner{Type: OwnerShop, ID: day}
+	for _, i := range rng.Perm(len(items))[:min(ShopStockSize, len(items))] {
+		err = AddItem(tx, owner, items[i], ShopCountDice.Roll(rng))
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Pay for one of an item from the shop. Returns ErrNoItem if it sold out,
+// ErrTooPoor or ErrCarryFull.
+func BuyItem(db *sql.DB, character_id int, shop Owner, item_id int, price int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = RemoveItem(tx, shop, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	owner := CharacterOwner(character_id)
+	err = checkCarry(tx, owner, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = AddItem(tx, owner, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	res, err := tx.Exec(
+		"UPDATE Character SET shinies = shinies - ?1 WHERE id = ?2 AND shinies >= ?1",
+		price, character_id,
+	)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Join(ErrTooPoor, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Sell one of an item to the shop, which puts it on the shelf. Returns
+// ErrNoItem if the character does not carry it.
+func SellItem(db *sql.DB, character_id int, shop Owner, item_id int, price int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = RemoveItem(tx, CharacterOwner(character_id), item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = AddItem(tx, shop, item_id, 1)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("UPDATE Character SET shinies = shinies + ? WHERE id = ?", price, character_id)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Games of chance.
+const (
+	GameDice    = "dice"
+	GameLottery = "lottery"
+)
+
+// Every bet placed, for auditing the economy. Lottery tickets are paid when
+// drawn.
+const createWagerTable = `
+	CREATE TABLE Wager (
+		id INTEGER PRIMARY KEY,
+		character_id INTEGER NOT NULL REFERENCES Character (id) ON DELETE CASCADE,
+		game TEXT NOT NULL CHECK (game IN ('dice', 'lottery')),
+		bet INTEGER NOT NULL CHECK (bet > 0),
+		payout INTEGER NOT NULL DEFAULT 0 CHECK (payout >= 0),
+		drawn INTEGER NOT NULL DEFAULT 1 CHECK (drawn IN (0, 1)),
+		placed INTEGER NOT NULL
+	) STRICT;
+	`
+
+func CreateWagerTable(db *sql.DB) error {
+	_, err := db.Exec(createWagerTable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Take a bet from a character and log it, paying out at once unless it is a
+// lottery ticket. Returns ErrTooPoor if they cannot cover it.
+func PlaceWager(db *sql.DB, character_id int, game string, bet int, payout int, placed time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		"UPDATE Character SET shinies = shinies - ?1 + ?2 WHERE id = ?3 AND shinies >= ?1",
+		bet, payout, character_id,
+	)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Join(ErrTooPoor, tx.Rollback())
+	}
+	_, err = tx.Exec(`
+		INSERT INTO Wager (character_id, game, bet, payout, drawn, placed)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`, character_id, game, bet, payout, game != GameLottery, placed.Unix())
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Shinies riding on the next lottery draw.
+func LotteryPot(db *sql.DB) (int, error) {
+	var pot int
+	err := db.QueryRow(
+		"SELECT COALESCE(SUM(bet), 0) FROM Wager WHERE game = 'lottery' AND drawn = 0",
+	).Scan(&pot)
+	return pot, err
+}
+
+// Draw a winning ticket, each shiny bet one chance, and pay them the pot
+// less the house's cut. Tickets belong to the player, so the winnings go to
+// their living goblin even if the one who bought the ticket has died. A
+// player with no living goblin cannot win, but their bet stays in the pot.
+// Returns the winner's name and winnings, or an empty name if no one could
+// win.
+func DrawLottery(db *sql.DB, r *rand.Rand, houseEdge float64) (string, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT Wager.id, COALESCE((
+			SELECT Living.id FROM Character AS Living
+			WHERE Living.user_id = Placed.user_id AND Living.alive = 1
+			ORDER BY Living.id DESC LIMIT 1
+		), 0), Wager.bet
+		FROM Wager LEFT JOIN Character AS Placed ON Placed.id = Wager.character_id
+		WHERE Wager.game = 'lottery' AND Wager.drawn = 0
+		ORDER BY Wager.id
+		`)
+	if err != nil {
+		return "", 0, errors.Join(err, tx.Rollback())
+	}
+	type ticket struct {
+		ID, CharacterID, Bet int
+	}
+	tickets := make([]ticket, 0, 16)
+	pot, chances := 0, 0
+	for rows.Next() {
+		var t ticket
+		if err = rows.Scan(&t.ID, &t.CharacterID, &t.Bet); err != nil {
+			rows.Close()
+			return "", 0, errors.Join(err, tx.Rollback())
+		}
+		pot += t.Bet
+		if t.CharacterID != 0 {
+			tickets = append(tickets, t)
+			chances += t.Bet
+		}
+	}
+	rows.Close()
+	if pot == 0 {
+		return "", 0, tx.Commit()
+	}
+
+	_, err = tx.Exec("UPDATE Wager SET drawn = 1 WHERE game = 'lottery' AND drawn = 0")
+	if err != nil {
+		return "", 0, errors.Join(err, tx.Rollback())
+	}
+	if chances == 0 {
+		return "", 0, tx.Commit()
+	}
+
+	roll := r.IntN(chances)
+	winner := tickets[0]
+	for _, t := range tickets {
+		if roll < t.Bet {
+			winner = t
+			break
+		}
+		roll -= t.Bet
+	}
+	winnings := int(float64(pot) * (1 - houseEdge))
+
+	_, err = tx.Exec("UPDATE Wager SET payout = ? WHERE id = ?", winnings, winner.ID)
+	if err != nil {
+		return "", 0, errors.Join(err, tx.Rollback())
+	}
+	var name string
+	err = tx.QueryRow(
+		"UPDATE Character SET shinies = shinies + ? WHERE id = ? RETURNING name",
+		winnings, winner.CharacterID,
+	).Scan(&name)
+	if err != nil {
+		return "", 0, errors.Join(err, tx.Rollback())
+	}
+
+	return name, winnings, tx.Commit()
+}
+
+// Sweep up everything left lying in the dungeon.
+func ClearRooms(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM ItemInstance WHERE owner_type = 'room'")
+	return err
+}
+
+// Remember what an item is. Knowing it twice is harmless.
+func LearnItem(db *sql.DB, character_id int, item_id int) error {
+	_, err := db.Exec(
+		"INSERT OR IGNORE INTO ItemKnowledge (character_id, item_id) VALUES (?, ?)",
+		character_id, item_id,
+	)
+	return err
+}
+
+func AwardCharacter(db *sql.DB, character_id int, shinies int, xp int) error {
+	_, err := db.Exec(
+		"UPDATE Character SET shinies = shinies + ?, experience = experience + ? WHERE id = ?",
+		shinies, xp, character_id,
+	)
+	return err
+}
+
+// Raise a goblin to level, adding gains to their stats in StatNames order.
+func LevelCharacter(db *sql.DB, character_id int, level int, gains [3]int, hp int) error {
+	_, err := db.Exec(`
+		UPDATE Character SET
+		level = ?,
+		might = might + ?,
+		agility = agility + ?,
+		will = will + ?,
+		hp = hp + ?
+		WHERE id = ?
+		`,
+		level, gains[0], gains[1], gains[2], hp, character_id,
+	)
+	return err
+}
+
+// Dead characters are kept for posterity.
+func KillCharacter(db *sql.DB, character_id int) error {
+	_, err := db.Exec("UPDATE Character SET alive = 0 WHERE id = ?", character_id)
+	return err
+}
+
+func DeleteCharacter(db *sql.DB, twitch_id string) error {
+	_, err := db.Exec(`DELETE FROM User WHERE twitch_id = ?`, twitch_id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Bumped with each migration. Stored in PRAGMA user_version.
+const SchemaVersion = 11
+
+// Bring a database made by an older version of the game up to date.
+func MigrateGameDB(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version < 1 {
+		err = migrateMonsters(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 1: %w", err)
+		}
+	}
+	if version < 2 {
+		err = migrateBehaviors(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 2: %w", err)
+		}
+	}
+	if version < 3 {
+		err = migrateDeaths(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 3: %w", err)
+		}
+	}
+	if version < 4 {
+		err = migrateSpells(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 4: %w", err)
+		}
+	}
+	if version < 5 {
+		err = migrateEffects(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 5: %w", err)
+		}
+	}
+	if version < 6 {
+		err = migrateAppearances(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 6: %w", err)
+		}
+	}
+	if version < 7 {
+		err = migrateInventory(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 7: %w", err)
+		}
+	}
+	if version < 8 {
+		err = migrateItemModifiers(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 8: %w", err)
+		}
+	}
+	if version < 9 {
+		err = migrateBirthSigns(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 9: %w", err)
+		}
+	}
+	if version < 10 {
+		err = migrateShop(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 10: %w", err)
+		}
+	}
+	if version < 11 {
+		err = migrateWagers(db)
+		if err != nil {
+			return fmt.Errorf("migrate to version 11: %w", err)
+		}
+	}
+
+	return SyncCommands(db)
+}
+
+// True if the table has the column.
+func columnExists(tx *sql.Tx, table string, column string) (bool, error) {
+	var n int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// Add default items the database does not have yet. Only fills in columns
+// from the first release.
+func addDefaultItems(tx *sql.Tx) error {
+	defaultItems, _, err := LoadDefaultItems()
+	if err != nil {
+		return err
+	}
+
+	for itemType, id := range DefaultItemTypes {
+		_, err = tx.Exec("INSERT OR IGNORE INTO ItemType (id, type) VALUES (?, ?)", id, itemType)
+		if err != nil {
+			return err
+		}
+	}
+	for _, item := range defaultItems {
+		_, err = tx.Exec(`
+			INSERT INTO Item (name, type_id, value, attack, defense, description)
+			SELECT ?1, ?2, ?3, ?4, ?5, ?6
+			WHERE NOT EXISTS (SELECT 1 FROM Item WHERE name = ?1)
+			`, item.Name, DefaultItemTypes[item.Type], item.Value,
+			item.Attack, item.Defense, item.Description,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add drops from the default loot tables the database does not have yet.
+func syncLootDrops(tx *sql.Tx) error {
+	lootTables := []DatabaseLootTable{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/loot_tables.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &lootTables)
+	if err != nil {
+		return err
+	}
+
+	dropStmt, err := tx.Prepare(`
+		INSERT INTO LootDrop (loot_table_id, item_id, chance)
+		SELECT LootTable.id, Item.id, ?1 FROM LootTable, Item
+		WHERE LootTable.name = ?2 AND Item.name = ?3 AND NOT EXISTS (
+			SELECT 1 FROM LootDrop
+			WHERE loot_table_id = LootTable.id AND item_id = Item.id
+		)
+		`)
+	if err != nil {
+		return err
+	}
+	defer dropStmt.Close()
+
+	for _, lt := range lootTables {
+		for _, drop := range lt.Drops {
+			_, err = dropStmt.Exec(drop.Chance, lt.Name, drop.Item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Version 1 brought in the bestiary. Loot tables name items from later
+// versions too, so those are added first.
+func migrateMonsters(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = addDefaultItems(tx)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	err = CreateMonsterTables(db)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("PRAGMA user_version = 1")
+	return err
+}
+
+// Version 2 gave monsters their behaviors.
+func migrateBehaviors(db *sql.DB) error {
+	monsters := []DatabaseMonster{}
+	data, err := os.ReadFile(GetPathPrefix() + "data/monsters.json")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &monsters)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Made by version 1 from the latest data, the table may have it already.
+	ok, err := columnExists(tx, "Monster", "behavior")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	} else if !ok {
+		_, err = tx.Exec("ALTER TABLE Monster ADD COLUMN behavior TEXT NOT NULL DEFAULT 'brute'")
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+	for _, m := range monsters {
+		_, err = tx.Exec("UPDATE Monster SET behavior = ? WHERE name = ?", m.Behavior, m.Name)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+	_, err = tx.Exec("PRAGMA user_version = 2")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Version 3 let goblins die. Everyone from before then is still alive.
+func migrateDeaths(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE Character ADD COLUMN alive INTEGER NOT NULL DEFAULT 1 CHECK (alive IN (0, 1))")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("PRAGMA user_version = 3")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Version 4 brought in spells. Goblins from before then learn the starting ones.
+func migrateSpells(db *sql.DB) error {
+	err := CreateEffectTable(db)
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(data, &defaultItems)
+	err = CreateSpellTables(db)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(`
-	CREATE TABLE ItemType (
-		id INTEGER PRIMARY KEY,
-		type TEXT UNIQUE NOT NULL
-	) STRICT;
-	`)
+
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(`
-	CREATE TABLE Item (
-		id INTEGER PRIMARY KEY,
-		name TEXT NOT NULL,
-		type_id INTEGER NOT NULL REFERENCES ItemType (id),
-		value INTEGER NOT NULL,
-		attack TEXT NOT NULL,
-		defense INTEGER NOT NULL,
-		description TEXT NOT NULL
-	) STRICT;
+
+	_, err = tx.Exec(`
+	INSERT INTO CharacterSpell (character_id, spell_id)
+	SELECT Character.id, Spell.id FROM Character, Spell WHERE Spell.starting = 1
 	`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("PRAGMA user_version = 4")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Version 5 gave items and traps effects. Effect took two new kinds, which
+// means building the table again.
+func migrateEffects(db *sql.DB) error {
+	defaultItems, _, err := LoadDefaultItems()
 	if err != nil {
 		return err
 	}
@@ -115,143 +2191,174 @@ func CreateItemTable(db *sql.DB) error {
 		return err
 	}
 
-	itemTypeStmt, err := tx.Prepare("INSERT INTO ItemType (id, type) VALUES (?, ?)")
+	_, err = tx.Exec(`
+	CREATE TABLE NewEffect (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL CHECK (
+			kind IN ('damage', 'heal', 'buff', 'sleep', 'light', 'teleport', 'identify')
+		),
+		target TEXT NOT NULL CHECK (target IN ('self', 'ally', 'monster', 'party')),
+		dice TEXT NOT NULL DEFAULT '',
+		stat TEXT NOT NULL DEFAULT '',
+		rounds INTEGER NOT NULL DEFAULT 0 CHECK (rounds >= 0)
+	) STRICT;
+	INSERT INTO NewEffect SELECT * FROM Effect;
+	DROP TABLE Effect;
+	ALTER TABLE NewEffect RENAME TO Effect;
+	`)
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer itemTypeStmt.Close()
-
-	itemStmt, err := tx.Prepare("INSERT INTO Item (name, type_id, value, attack, defense, description) VALUES (?, ?, ?, ?, ?, ?)")
+	_, err = tx.Exec(createItemEffectTable)
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer itemStmt.Close()
 
-	for itemType, id := range defaultItemTypes {
-		_, err = itemTypeStmt.Exec(id, itemType)
+	// The new consumables, what every item does and where to find them.
+	err = addDefaultItems(tx)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	effectStmt, err := tx.Prepare(InsertEffect)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer effectStmt.Close()
+	itemEffectStmt, err := tx.Prepare("INSERT INTO ItemEffect (item_id, effect_id) VALUES (?, ?)")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	defer itemEffectStmt.Close()
+	for _, item := range defaultItems {
+		var itemID int64
+		err = tx.QueryRow("SELECT id FROM Item WHERE name = ? ORDER BY id LIMIT 1", item.Name).Scan(&itemID)
 		if err != nil {
 			return errors.Join(err, tx.Rollback())
 		}
-	}
-
-	for _, item := range defaultItems {
-		_, err = itemStmt.Exec(item.Name, defaultItemTypes[item.Type], item.Value, item.Attack, item.Defense, item.Description)
+		err = AttachEffects(effectStmt, itemEffectStmt, itemID, item.Effects)
 		if err != nil {
 			return errors.Join(err, tx.Rollback())
 		}
 	}
-
+	err = syncLootDrops(tx)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// User <- Character <- Inventory
-func CreateUserTable(db *sql.DB) error {
-	_, err := db.Exec(`
-	CREATE TABLE User (
-		id INTEGER PRIMARY KEY,
-		twitch_id TEXT UNIQUE NOT NULL
-	) STRICT;
-	`)
+	err = CreateTrapTables(db)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	_, err = db.Exec("PRAGMA user_version = 5")
+	return err
 }
 
-// TODO: Spells List / Magic
-func CreateCharacterTable(db *sql.DB) error {
-	_, err := db.Exec(`
-	CREATE TABLE Character (
-		id INTEGER PRIMARY KEY,
-		name TEXT NOT NULL,
-
-		user_id INTEGER NOT NULL REFERENCES User (id) ON DELETE CASCADE,
-		armor_id INTEGER NOT NULL REFERENCES Item (id),
-		weapon_id INTEGER NOT NULL REFERENCES Item (id),
-
-		level INTEGER NOT NULL,
-		experience INTEGER NOT NULL,
-		shinies INTEGER NOT NULL,
+// Version 6 disguised magic items until identified, which needs a world seed
+// to shuffle their looks with.
+func migrateAppearances(db *sql.DB) error {
+	defaultItems, pools, err := LoadDefaultItems()
+	if err != nil {
+		return err
+	}
+	seed := uint64(time.Now().UnixNano())
+	appearances, err := ShuffleAppearances(seed, defaultItems, pools)
+	if err != nil {
+		return err
+	}
 
-		might INTEGER NOT NULL, 
-		agility INTEGER NOT NULL, 
-		will INTEGER NOT NULL ,
+	err = CreateWorldTable(db, seed)
+	if err != nil {
+		return err
+	}
+	err = CreateItemKnowledgeTable(db)
+	if err != nil {
+		return err
+	}
 
-		hp INTEGER NOT NULL
-	) STRICT;
-	`)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = tx.Exec("ALTER TABLE Item ADD COLUMN appearance TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	for _, item := range defaultItems {
+		_, err = tx.Exec("UPDATE Item SET appearance = ? WHERE name = ?", appearances[item.Name], item.Name)
+		if err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+	}
+	_, err = tx.Exec("PRAGMA user_version = 6")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
 }
 
-// Empty slots point to the "Empty" item.
-// The number of slots here forms a hard limit for all inventories in game
-func CreateInventoryTable(db *sql.DB) error {
-	_, err := db.Exec(`
-	CREATE TABLE Inventory (
-		id INTEGER PRIMARY KEY,
-		parent_id INTEGER NOT NULL REFERENCES Character (id) ON DELETE CASCADE,
-		item_id_1 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_2 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_3 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_4 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_5 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_6 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_7 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_8 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_9 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
-		item_id_10 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1
-	) STRICT;
-	`)
+// Version 7 replaced the fixed Inventory slots with ItemInstance rows.
+func migrateInventory(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	_, err = tx.Exec(createItemInstanceTable)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
 
-func CreateCommandTables(db *sql.DB) error {
-	defaultCommandTypes := map[string]int{
-		"admin":   1,
-		"global":  2,
-		"combat":  3,
-		"explore": 4,
-	}
-	defaultCommands := []struct {
-		Command string
-		Type    string
-	}{
-		{"inspect", "global"},
-		{"join", "global"},
-		{"sneak", "explore"},
-		{"attack", "combat"},
+	// Copies of an item in several old slots become one stack, and the
+	// stacks are packed into the lowest slots in their old order. Item 1 is
+	// the empty placeholder.
+	_, err = tx.Exec(`
+		WITH Slot AS (
+			SELECT parent_id, item_id_1 AS item_id, 1 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_2 AS item_id, 2 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_3 AS item_id, 3 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_4 AS item_id, 4 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_5 AS item_id, 5 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_6 AS item_id, 6 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_7 AS item_id, 7 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_8 AS item_id, 8 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_9 AS item_id, 9 AS slot FROM Inventory UNION ALL
+			SELECT parent_id, item_id_10 AS item_id, 10 AS slot FROM Inventory
+		), Stack AS (
+			SELECT parent_id, item_id, COUNT(*) AS count, MIN(slot) AS first
+			FROM Slot
+			WHERE item_id != 1
+			GROUP BY parent_id, item_id
+		)
+		INSERT INTO ItemInstance (item_id, owner_type, owner_id, slot, count)
+		SELECT item_id, 'character', parent_id,
+			ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY first), count
+		FROM Stack
+		`)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
 	}
 
-	_, err := db.Exec(`
-	CREATE TABLE CommandType (
-		id INTEGER PRIMARY KEY,
-		type TEXT UNIQUE NOT NULL
-	) STRICT;
-	`)
+	_, err = tx.Exec("DROP TABLE Inventory")
 	if err != nil {
-		return err
+		return errors.Join(err, tx.Rollback())
 	}
-	_, err = db.Exec(`
-	CREATE TABLE Command (
-		id INTEGER PRIMARY KEY,
-		command TEXT UNIQUE NOT NULL,
-		type_id INTEGER NOT NULL REFERENCES CommandType (id)
-	) STRICT;
-	`)
+	_, err = tx.Exec("PRAGMA user_version = 7")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// Version 8 added the Agility and ranged modifiers of arms and armor.
+func migrateItemModifiers(db *sql.DB) error {
+	defaultItems, _, err := LoadDefaultItems()
 	if err != nil {
 		return err
 	}
@@ -261,115 +2368,110 @@ func CreateCommandTables(db *sql.DB) error {
 		return err
 	}
 
-	cmdTypeStmt, err := tx.Prepare("INSERT INTO CommandType (id, type) VALUES (?, ?)")
+	_, err = tx.Exec("ALTER TABLE Item ADD COLUMN agility INTEGER NOT NULL DEFAULT 0")
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer cmdTypeStmt.Close()
-
-	cmdStmt, err := tx.Prepare("INSERT INTO Command (command, type_id) VALUES (?, ?)")
+	_, err = tx.Exec("ALTER TABLE Item ADD COLUMN ranged INTEGER NOT NULL DEFAULT 0 CHECK (ranged IN (0, 1))")
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer cmdStmt.Close()
 
-	for cmdType, id := range defaultCommandTypes {
-		_, err = cmdTypeStmt.Exec(id, cmdType)
-		if err != nil {
-			return errors.Join(err, tx.Rollback())
-		}
+	// The arms and armor that came with them, and where to find them.
+	err = addDefaultItems(tx)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
 	}
-
-	for _, cmd := range defaultCommands {
-		_, err = cmdStmt.Exec(cmd.Command, defaultCommandTypes[cmd.Type])
+	for _, item := range defaultItems {
+		_, err = tx.Exec(
+			"UPDATE Item SET agility = ?, ranged = ? WHERE name = ?",
+			item.Agility, item.Ranged, item.Name,
+		)
 		if err != nil {
 			return errors.Join(err, tx.Rollback())
 		}
 	}
-
-	err = tx.Commit()
+	err = syncLootDrops(tx)
 	if err != nil {
-		return err
+		return errors.Join(err, tx.Rollback())
+	}
+	_, err = tx.Exec("PRAGMA user_version = 8")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func CreateCharacter(db *sql.DB, twitch_id string) error {
+// Version 9 added birth signs. Goblins from before then are given one at
+// random.
+func migrateBirthSigns(db *sql.DB) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	// id INTEGER PRIMARY KEY,
-	// twitch_id INTEGER UNIQUE NOT NULL,
-	// character_id INTEGER NOT NULL REFERENCES Character (id)
-	userStmt, err := tx.Prepare(`
-		INSERT INTO User (
-		twitch_id
-		) VALUES (?)
-		`)
+	_, err = tx.Exec("ALTER TABLE Character ADD COLUMN sign TEXT NOT NULL DEFAULT ''")
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer userStmt.Close()
-
-	charStmt, err := tx.Prepare(`
-		INSERT INTO Character (
-		name,
-		user_id,
-		armor_id,
-		weapon_id,
-		level,
-		experience,
-		shinies,
-		might,
-		agility,
-		will,
-		hp
-		) VALUES (?, last_insert_rowid(), ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`)
+	cases := make([]string, len(BirthSigns))
+	args := make([]any, len(BirthSigns))
+	for i, s := range BirthSigns {
+		cases[i] = fmt.Sprintf("WHEN %d THEN ?", i)
+		args[i] = s.Name
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"UPDATE Character SET sign = CASE abs(random()) %% %d %s END",
+		len(BirthSigns), strings.Join(cases, " "),
+	), args...)
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer charStmt.Close()
-
-	invStmt, err := tx.Prepare("INSERT INTO Inventory (parent_id) VALUES (last_insert_rowid())")
+	_, err = tx.Exec("PRAGMA user_version = 9")
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-	defer invStmt.Close()
 
-	_, err = userStmt.Exec(twitch_id)
+	return tx.Commit()
+}
+
+// Version 10 opened the shop.
+func migrateShop(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return errors.Join(err, tx.Rollback())
+		return err
 	}
 
-	// TODO: Randomly generate values
-	_, err = charStmt.Exec(twitch_id, 1, 1, 1, 0, 0, 9, 9, 9, 4)
+	_, err = tx.Exec(createShopDayTable)
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
-
-	_, err = invStmt.Exec()
+	_, err = tx.Exec("PRAGMA user_version = 10")
 	if err != nil {
 		return errors.Join(err, tx.Rollback())
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// Version 11 opened the gambling dens.
+func migrateWagers(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func DeleteCharacter(db *sql.DB, twitch_id string) error {
-	_, err := db.Exec(`DELETE FROM User WHERE twitch_id = ?`, twitch_id)
+	_, err = tx.Exec(createWagerTable)
 	if err != nil {
-		return err
+		return errors.Join(err, tx.Rollback())
 	}
-	return nil
+	_, err = tx.Exec("PRAGMA user_version = 11")
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
 }
 
 func GetPathPrefix() string {
@@ -381,8 +2483,12 @@ func GetPathPrefix() string {
 }
 
 func NewGameDB(filename string) (*sql.DB, error) {
+	return OpenGameDB(GetPathPrefix() + "db/" + filename)
+}
+
+// Open the game database at path, creating it if it does not exist.
+func OpenGameDB(path string) (*sql.DB, error) {
 	dbFound := false
-	path := GetPathPrefix() + "db/" + filename
 	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
 		dbFound = true
 	}
@@ -391,7 +2497,13 @@ func NewGameDB(filename string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	} else if dbFound {
-		return db, nil
+		return db, MigrateGameDB(db)
+	}
+
+	seed := uint64(time.Now().UnixNano())
+	err = CreateWorldTable(db, seed)
+	if err != nil {
+		return nil, err
 	}
 
 	err = CreateCommandTables(db)
@@ -399,12 +2511,27 @@ func NewGameDB(filename string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	err = CreateItemTable(db)
+	err = CreateEffectTable(db)
 	if err != nil {
 		return nil, err
 	}
 
-	err = CreateInventoryTable(db)
+	err = CreateItemTable(db, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateTrapTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateMonsterTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateItemInstanceTable(db)
 	if err != nil {
 		return nil, err
 	}
@@ -414,10 +2541,35 @@ func NewGameDB(filename string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	err = CreateSpellTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateItemKnowledgeTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateShopTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CreateWagerTable(db)
+	if err != nil {
+		return nil, err
+	}
+
 	err = CreateUserTable(db)
 	if err != nil {
 		return nil, err
 	}
 
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion))
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"database/sql"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestInitDB(t *testing.T) {
 	_, err := NewGameDB("test.db")
@@ -30,9 +36,86 @@ func TestCreateDeleteCharacter(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	CreateCharacter(db, "TestChar1")
-	CreateCharacter(db, "TestChar2")
+	r := rand.New(rand.NewPCG(1, 2))
+	CreateCharacter(db, r, "TestChar1", "TestChar1")
+	CreateCharacter(db, r, "TestChar2", "TestChar2")
 	DeleteCharacter(db, "TestChar1")
-	CreateCharacter(db, "TestChar3")
-	CreateCharacter(db, "TestChar4")
+	CreateCharacter(db, r, "TestChar3", "TestChar3")
+	CreateCharacter(db, r, "TestChar4", "TestChar4")
+}
+
+// A copy of the first release's database, made from testdata/baseline.sql.
+func newBaselineDB(t *testing.T) string {
+	t.Helper()
+	script, err := os.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.db")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	db, err := OpenGameDB(newBaselineDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := MigrateGameDB(db); err != nil {
+		t.Fatal("migrating twice:", err)
+	}
+	q, err := InitQuery(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseQuery(q)
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != SchemaVersion {
+		t.Fatalf("user_version %d, want %d", version, SchemaVersion)
+	}
+	if err := q[QueryCommand].QueryRow("begin").Scan(new(string), new(string)); err != nil {
+		t.Fatal("new commands were not added:", err)
+	}
+
+	g := &GameServer{DB: db, Query: q, Rand: rand.New(rand.NewPCG(1, 2))}
+	if _, err := g.PickMonster(1); err != nil {
+		t.Fatal("no bestiary:", err)
+	}
+	pc, err := g.LoadCharacter("1001")
+	if err != nil || pc.Vitality != Alive || FindBirthSign(pc.Sign).Name == "" {
+		t.Fatalf("old goblin came back wrong: %+v %v", pc, err)
+	}
+	if len(pc.Spells) != 3 {
+		t.Fatalf("old goblin knows %d spells, want the 3 starting ones", len(pc.Spells))
+	}
+	potion, err := g.LoadItem(4)
+	if err != nil || len(potion.Effects) != 1 || potion.Appearance == "" {
+		t.Fatalf("old potion came back wrong: %+v %v", potion, err)
+	}
+	if err := LearnItem(db, pc.ID, potion.ID); err != nil {
+		t.Fatal("cannot learn items:", err)
+	}
+	var ranged bool
+	if err := db.QueryRow("SELECT ranged FROM Item WHERE name = 'Bone Bow'").Scan(&ranged); err != nil || !ranged {
+		t.Fatal("new arms came without their modifiers:", err)
+	}
+	if err := StockShop(db, 1); err != nil {
+		t.Fatal("cannot open the shop:", err)
+	}
+	if _, err := LotteryPot(db); err != nil {
+		t.Fatal("cannot count the lottery pot:", err)
+	}
+	if _, err := g.PickTrap(1); err != nil {
+		t.Fatal("no traps:", err)
+	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+type Vitality int
+
+const (
+	Alive  Vitality = iota
+	Downed          // At 0 HP. Cannot act, and hits reduce Might instead
+	Dead
+)
+
+// Stat checks succeed on a roll at or under the stat.
+var CheckDice = MustParseDice("1d20")
+
+func (g *GameServer) StatCheck(stat int) bool {
+	return CheckDice.Roll(g.Rand) <= stat
+}
+
+// Members who can still be attacked: standing or downed.
+func (g *GameServer) Targets() []string {
+	targets := make([]string, 0, len(g.Party.Members))
+	for _, uid := range g.Party.Members {
+		if g.Party.PlayerCharacters[uid].Vitality != Dead {
+			targets = append(targets, uid)
+		}
+	}
+	return targets
+}
+
+// Apply damage to a party member. A goblin at 0 HP is downed. Hits on a
+// downed goblin take Might instead, and each one needs a Might check to
+// survive. At 0 Might the goblin dies.
+func (g *GameServer) Hurt(uid string, damage int) {
+	pc, ok := g.Party.PlayerCharacters[uid]
+	if !ok || damage <= 0 || pc.Vitality == Dead {
+		return
+	}
+
+	if pc.Vitality == Alive {
+		pc.HP = max(0, pc.HP-damage)
+		if pc.HP == 0 {
+			pc.Vitality = Downed
+			m := pc.Name + " is down and vulnerable!"
+			log.Println("game:", m)
+			g.Say(PriorityHigh, m)
+		}
+		g.Party.PlayerCharacters[uid] = pc
+		return
+	}
+
+	pc.Might = max(0, pc.Might-damage)
+	g.Party.PlayerCharacters[uid] = pc
+	if pc.Might == 0 || !g.StatCheck(pc.Might) {
+		g.Kill(uid)
+		return
+	}
+	g.Say(PriorityHigh, fmt.Sprintf("%s clings to life. Might %d.", pc.Name, pc.Might))
+}
+
+// The goblin dies for good. The death is recorded at once so it survives a
+// crash, and the goblin leaves the party with no share of the treasure.
+func (g *GameServer) Kill(uid string) {
+	pc := g.Party.PlayerCharacters[uid]
+	pc.Vitality = Dead
+	g.Party.PlayerCharacters[uid] = pc
+
+	err := KillCharacter(g.DB, pc.ID)
+	if err != nil {
+		log.Println("game:", err)
+	}
+
+	m := pc.Name + " has died!"
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+
+	g.Party.Remove(uid)
+}
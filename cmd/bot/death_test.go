@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDownedCannotAct(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+
+	g.Hurt("1", 1000)
+	if pc := g.Party.PlayerCharacters["1"]; pc.Vitality != Downed || pc.HP != 0 {
+		t.Fatalf("Alice should be downed: %+v", pc)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!attack", now)
+	if _, ok := g.Delve.Combat.Choices["1"]; ok {
+		t.Fatal("downed goblin chose an action")
+	}
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	if g.Delve.Combat.Round != 2 {
+		t.Fatal("round should resolve once everyone standing has acted")
+	}
+	if g.Delve.Combat.Monster.HP != 100 {
+		t.Fatal("downed goblin attacked")
+	}
+}
+
+func TestDeathIsRecorded(t *testing.T) {
+	g, now := newTestCombat(t, testMonster())
+	alice := g.Party.PlayerCharacters["1"]
+
+	g.Hurt("1", 1000)
+	g.Hurt("1", alice.Might)
+	if g.Party.IsMember("1") || g.Party.Leader != "2" {
+		t.Fatal("dead goblin should leave the party")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "Alice has died!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	var alive int
+	err := g.DB.QueryRow("SELECT alive FROM Character WHERE id = ?", alice.ID).Scan(&alive)
+	if err != nil || alive != 0 {
+		t.Fatalf("death not recorded: alive=%d err=%v", alive, err)
+	}
+
+	g.EndDelve()
+	sendCommand(t, g, "1", "Alice", "!join", now)
+	reborn := g.Party.PlayerCharacters["1"]
+	if reborn.ID == alice.ID || reborn.ID == 0 || reborn.Vitality != Alive {
+		t.Fatalf("dead goblin was not replaced: %+v", reborn)
+	}
+}
+
+func TestMightCheckSurvival(t *testing.T) {
+	g, _ := newTestCombat(t, testMonster())
+
+	g.Hurt("1", 1000)
+	pc := g.Party.PlayerCharacters["1"]
+	pc.Might = 100
+	g.Party.PlayerCharacters["1"] = pc
+
+	g.Hurt("1", 3)
+	pc = g.Party.PlayerCharacters["1"]
+	if pc.Vitality != Downed || pc.Might != 97 {
+		t.Fatalf("hit on a downed goblin should take Might: %+v", pc)
+	}
+}
+
+func TestFallenPartyCrawlsHome(t *testing.T) {
+	g, now := newTestCombat(t, testMonster())
+	g.Delve.Shinies = 50
+
+	g.Hurt("1", 1000)
+	g.Hurt("2", 1000)
+	g.ResolveRound(now)
+	if g.Phase != PhaseTown {
+		t.Fatal("party with no one standing should fall")
+	}
+
+	var shinies int
+	err := g.DB.QueryRow("SELECT shinies FROM Character WHERE name = 'Alice'").Scan(&shinies)
+	if err != nil || shinies != 0 {
+		t.Fatalf("fallen party was paid %d shinies (%v)", shinies, err)
+	}
+}
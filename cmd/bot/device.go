@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type AuthFlow int
+
+const (
+	// Browser redirect to a local TLS server. See MakeAuthRequest.
+	AuthCodeFlow AuthFlow = iota
+	// Enter a code on any device. Works on headless machines.
+	AuthDeviceFlow
+)
+
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	// Twitch reports device intervals and expiry in seconds. Tests shrink
+	// this to keep polling fast.
+	DevicePollUnit = time.Second
+
+	ErrDeviceCodeExpired = errors.New("device: code expired before authorization")
+)
+
+func ParseAuthFlow(s string) (AuthFlow, error) {
+	switch strings.ToLower(s) {
+	case "code", "":
+		return AuthCodeFlow, nil
+	case "device":
+		return AuthDeviceFlow, nil
+	}
+	return AuthCodeFlow, fmt.Errorf("auth: unknown flow %q (want code or device)", s)
+}
+
+// Run the selected authorization flow to obtain a user token.
+func (b *ChatBot) Authorize(flow AuthFlow) {
+	switch flow {
+	case AuthDeviceFlow:
+		err := b.GetDeviceAuthToken()
+		if err != nil {
+			log.Fatalln("auth:", err)
+		}
+	default:
+		b.MakeAuthRequest()
+		b.GetUserAuthToken()
+	}
+}
+
+// Start a device authorization. The user code must be shown to the user.
+//
+// https://dev.twitch.tv/docs/authentication/getting-tokens-oauth/#device-code-grant-flow
+func (b *ChatBot) RequestDeviceCode() (*JSONDeviceCode, error) {
+	form := url.Values{}
+	form.Set("client_id", b.ClientID)
+	form.Set("scopes", strings.Join(BotScopes, " "))
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    Endpoint(b.AuthURL, "/oauth2/device"),
+		Body:   io.NopCloser(strings.NewReader(form.Encode())),
+		Header: http.Header{},
+	}
+	defer req.Body.Close()
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	resBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device: %s %s", response.Status, resBody)
+	}
+
+	code := &JSONDeviceCode{}
+	err = json.Unmarshal(resBody, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// Poll the token endpoint until the user approves the device code. Waits
+// the server's interval between polls, adds 5 units on slow_down as RFC 8628
+// requires, and backs off exponentially on network and server errors.
+//
+// https://datatracker.ietf.org/doc/html/rfc8628#section-3.5
+func (b *ChatBot) PollDeviceToken(code *JSONDeviceCode) error {
+	form := url.Values{}
+	form.Set("client_id", b.ClientID)
+	if b.clientSecret != "" {
+		form.Set("client_secret", b.clientSecret)
+	}
+	form.Set("scopes", strings.Join(BotScopes, " "))
+	form.Set("device_code", code.DeviceCode)
+	form.Set("grant_type", DeviceGrantType)
+
+	interval := time.Duration(code.Interval) * DevicePollUnit
+	if code.Interval <= 0 {
+		interval = 5 * DevicePollUnit
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * DevicePollUnit)
+	backoff := Backoff{Min: interval, Max: 60 * DevicePollUnit}
+	wait := interval
+
+	for {
+		if time.Now().Add(wait).After(deadline) {
+			return ErrDeviceCodeExpired
+		}
+		time.Sleep(wait)
+
+		err := b.requestUserToken(form)
+		if err == nil {
+			return nil
+		}
+
+		tokenErr := &TokenError{}
+		if !errors.As(err, &tokenErr) || tokenErr.Status >= 500 {
+			log.Println(err)
+			wait = backoff.Next()
+			continue
+		}
+		backoff.Reset()
+
+		switch tokenErr.Message {
+		case "authorization_pending":
+			wait = interval
+		case "slow_down":
+			interval += 5 * DevicePollUnit
+			backoff.Min = interval
+			wait = interval
+		case "invalid device code", "expired_token":
+			return ErrDeviceCodeExpired
+		default:
+			return err
+		}
+	}
+}
+
+// Headless alternative to MakeAuthRequest and GetUserAuthToken. Prints a
+// code for the bot account owner to enter on any device, then waits for the
+// resulting user token.
+func (b *ChatBot) GetDeviceAuthToken() error {
+	code, err := b.RequestDeviceCode()
+	if err != nil {
+		return err
+	}
+
+	fmt.Print("While logged on the bot account, visit the link below and enter the code:\n\n")
+	fmt.Println(code.VerificationURI)
+	fmt.Print("\n    ", code.UserCode, "\n\n")
+
+	err = b.PollDeviceToken(code)
+	if err != nil {
+		return err
+	}
+
+	return b.ValidateUserAuthToken()
+}
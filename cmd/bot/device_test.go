@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeviceAuthFlow(t *testing.T) {
+	DevicePollUnit = time.Millisecond
+	defer func() { DevicePollUnit = time.Second }()
+
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/device", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(JSONDeviceCode{
+			DeviceCode:      "device",
+			ExpiresIn:       1800,
+			Interval:        5,
+			UserCode:        "ABCDEFGH",
+			VerificationURI: "https://www.twitch.tv/activate",
+		})
+	})
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != DeviceGrantType || r.Form.Get("device_code") != "device" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "invalid request"})
+			return
+		}
+		polls++
+		switch polls {
+		case 1, 3:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "authorization_pending"})
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "slow_down"})
+		case 4:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","expires_in":14000,"scope":["user:bot"],"token_type":"bearer"}`))
+		}
+	})
+	mux.HandleFunc("GET /oauth2/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(JSONTokenValidation{ClientID: "client", UserID: "bot", ExpiresIn: 14000})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	b := &ChatBot{
+		ClientID: "client",
+		UserID:   "bot",
+		AuthURL:  server.URL,
+	}
+	err := b.GetDeviceAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls != 5 {
+		t.Fatalf("token endpoint polled %d times, want 5", polls)
+	}
+
+	token := b.currentUserToken()
+	if token == nil || token.AccessToken != "access" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	if token.Expiry.IsZero() {
+		t.Fatal("device token expiry was not set")
+	}
+}
+
+func TestDeviceAuthExpired(t *testing.T) {
+	DevicePollUnit = time.Millisecond
+	defer func() { DevicePollUnit = time.Second }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "authorization_pending"})
+	}))
+	defer server.Close()
+
+	b := &ChatBot{ClientID: "client", AuthURL: server.URL}
+	err := b.PollDeviceToken(&JSONDeviceCode{DeviceCode: "device", ExpiresIn: 20, Interval: 5})
+	if err != ErrDeviceCodeExpired {
+		t.Fatalf("got %v, want ErrDeviceCodeExpired", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: 10 * time.Millisecond, Max: 80 * time.Millisecond}
+	for range 20 {
+		d := b.Next()
+		if d < b.Min || d > b.Max {
+			t.Fatalf("backoff %v outside [%v, %v]", d, b.Min, b.Max)
+		}
+	}
+	b.Reset()
+	if d := b.Next(); d != b.Min {
+		t.Fatalf("first backoff after reset was %v, want %v", d, b.Min)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Sanity limits for dice expressions.
+const (
+	DiceCountMax = 100
+	DiceSidesMax = 1000
+)
+
+var ErrDiceSyntax = errors.New("dice: invalid expression")
+
+// A dice expression such as 2d6+1, 1d4-1 or 4d6kh3.
+//
+//	[count]d<sides>[kh|kl|dh|dl<n>][+|-<modifier>]
+//
+// Keep high (kh) and keep low (kl) sum only the best or worst n dice. Drop
+// high (dh) and drop low (dl) are the same thing said the other way around.
+type Dice struct {
+	Count    int
+	Sides    int
+	Keep     int  // Dice summed. Zero keeps them all
+	KeepHigh bool // Keep the highest rolls rather than the lowest
+	Modifier int
+}
+
+func ParseDice(s string) (Dice, error) {
+	d := Dice{}
+	expr := strings.ToLower(strings.TrimSpace(s))
+	syntaxErr := fmt.Errorf("%w: %q", ErrDiceSyntax, s)
+
+	count, rest, ok := strings.Cut(expr, "d")
+	if !ok {
+		return d, syntaxErr
+	}
+	d.Count = 1
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return d, syntaxErr
+		}
+		d.Count = n
+	}
+
+	// Modifier
+	if i := strings.IndexAny(rest, "+-"); i >= 0 {
+		n, err := strconv.Atoi(rest[i:])
+		if err != nil {
+			return d, syntaxErr
+		}
+		d.Modifier = n
+		rest = rest[:i]
+	}
+
+	// Keep or drop
+	sides := rest
+	if i := strings.IndexAny(rest, "kd"); i >= 0 {
+		sides = rest[:i]
+		op := rest[i:]
+		if len(op) < 3 {
+			return d, syntaxErr
+		}
+		n, err := strconv.Atoi(op[2:])
+		if err != nil || n < 0 || n > d.Count {
+			return d, syntaxErr
+		}
+		switch op[:2] {
+		case "kh":
+			d.Keep, d.KeepHigh = n, true
+		case "kl":
+			d.Keep, d.KeepHigh = n, false
+		case "dl":
+			d.Keep, d.KeepHigh = d.Count-n, true
+		case "dh":
+			d.Keep, d.KeepHigh = d.Count-n, false
+		default:
+			return d, syntaxErr
+		}
+		if d.Keep == 0 {
+			return d, syntaxErr
+		}
+		if d.Keep == d.Count {
+			d.Keep, d.KeepHigh = 0, false
+		}
+	}
+
+	n, err := strconv.Atoi(sides)
+	if err != nil {
+		return d, syntaxErr
+	}
+	d.Sides = n
+
+	if d.Count < 1 || d.Count > DiceCountMax || d.Sides < 1 || d.Sides > DiceSidesMax {
+		return d, fmt.Errorf("%w: %q out of range", ErrDiceSyntax, s)
+	}
+
+	return d, nil
+}
+
+// Like ParseDice but panics. For expressions known at compile time.
+func MustParseDice(s string) Dice {
+	d, err := ParseDice(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Number of dice summed.
+func (d Dice) Kept() int {
+	if d.Keep == 0 {
+		return d.Count
+	}
+	return d.Keep
+}
+
+func (d Dice) Roll(rng *rand.Rand) int {
+	if d.Count == 0 {
+		return d.Modifier
+	}
+	rolls := make([]int, d.Count)
+	for i := range rolls {
+		rolls[i] = 1 + rng.IntN(d.Sides)
+	}
+
+	kept := rolls
+	if d.Keep > 0 {
+		slices.Sort(rolls)
+		if d.KeepHigh {
+			kept = rolls[d.Count-d.Keep:]
+		} else {
+			kept = rolls[:d.Keep]
+		}
+	}
+
+	total := d.Modifier
+	for _, r := range kept {
+		total += r
+	}
+	return total
+}
+
+func (d Dice) Min() int {
+	return d.Kept() + d.Modifier
+}
+
+func (d Dice) Max() int {
+	return d.Kept()*d.Sides + d.Modifier
+}
+
+// Expected roll. Keep and drop use the exact order statistics of the dice.
+func (d Dice) Mean() float64 {
+	if d.Count == 0 {
+		return float64(d.Modifier)
+	}
+	if d.Keep == 0 {
+		return float64(d.Count*(d.Sides+1))/2 + float64(d.Modifier)
+	}
+
+	// E[X_(j)] = sum over x of P(X_(j) >= x), where X_(j) is the jth lowest
+	// die. That holds when at least n-j+1 dice roll x or more.
+	n := d.Count
+	first, last := 1, d.Keep
+	if d.KeepHigh {
+		first, last = n-d.Keep+1, n
+	}
+
+	mean := float64(d.Modifier)
+	for j := first; j <= last; j++ {
+		for x := 2; x <= d.Sides; x++ {
+			p := float64(d.Sides-x+1) / float64(d.Sides)
+			mean += binomialTail(n, n-j+1, p)
+		}
+		mean++ // P(X_(j) >= 1) = 1
+	}
+	return mean
+}
+
+// P(at least k successes in n trials with success chance p).
+func binomialTail(n int, k int, p float64) float64 {
+	total := 0.0
+	for m := k; m <= n; m++ {
+		total += binomial(n, m) * math.Pow(p, float64(m)) * math.Pow(1-p, float64(n-m))
+	}
+	return total
+}
+
+func binomial(n int, k int) float64 {
+	c := 1.0
+	for i := 1; i <= k; i++ {
+		c = c * float64(n-k+i) / float64(i)
+	}
+	return c
+}
+
+func (d Dice) String() string {
+	if d.Count == 0 {
+		return strconv.Itoa(d.Modifier)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%dd%d", d.Count, d.Sides)
+	if d.Keep > 0 {
+		if d.KeepHigh {
+			fmt.Fprintf(&sb, "kh%d", d.Keep)
+		} else {
+			fmt.Fprintf(&sb, "kl%d", d.Keep)
+		}
+	}
+	if d.Modifier > 0 {
+		fmt.Fprintf(&sb, "+%d", d.Modifier)
+	} else if d.Modifier < 0 {
+		fmt.Fprintf(&sb, "%d", d.Modifier)
+	}
+	return sb.String()
+}
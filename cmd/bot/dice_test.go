@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Dice
+		str  string
+	}{
+		{"1d4", Dice{Count: 1, Sides: 4}, "1d4"},
+		{"d20", Dice{Count: 1, Sides: 20}, "1d20"},
+		{"2d6+1", Dice{Count: 2, Sides: 6, Modifier: 1}, "2d6+1"},
+		{"1d4-1", Dice{Count: 1, Sides: 4, Modifier: -1}, "1d4-1"},
+		{" 4D6kh3 ", Dice{Count: 4, Sides: 6, Keep: 3, KeepHigh: true}, "4d6kh3"},
+		{"4d6dl1", Dice{Count: 4, Sides: 6, Keep: 3, KeepHigh: true}, "4d6kh3"},
+		{"2d20kl1+2", Dice{Count: 2, Sides: 20, Keep: 1, Modifier: 2}, "2d20kl1+2"},
+		{"3d6kh3", Dice{Count: 3, Sides: 6}, "3d6"},
+	}
+	for _, tt := range tests {
+		d, err := ParseDice(tt.expr)
+		if err != nil {
+			t.Errorf("ParseDice(%q): %v", tt.expr, err)
+			continue
+		}
+		if d != tt.want || d.String() != tt.str {
+			t.Errorf("ParseDice(%q) = %+v %q, want %+v %q", tt.expr, d, d, tt.want, tt.str)
+		}
+	}
+
+	for _, bad := range []string{"", "4", "d", "1d", "0d6", "1d0", "xd6", "1d6+", "1d6++1", "2d6kh3", "2d6kh0", "2d6kx1", "1d6k", "101d6", "1d6 + 1"} {
+		if _, err := ParseDice(bad); !errors.Is(err, ErrDiceSyntax) {
+			t.Errorf("ParseDice(%q) should fail, got %v", bad, err)
+		}
+	}
+}
+
+func TestDiceRollBounds(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 11))
+	for _, expr := range []string{"1d4", "2d6+1", "1d4-1", "4d6kh3", "2d20kl1"} {
+		d := MustParseDice(expr)
+		sum := 0
+		const rolls = 20000
+		for range rolls {
+			r := d.Roll(rng)
+			if r < d.Min() || r > d.Max() {
+				t.Fatalf("%s rolled %d outside [%d, %d]", expr, r, d.Min(), d.Max())
+			}
+			sum += r
+		}
+		if mean := float64(sum) / rolls; math.Abs(mean-d.Mean()) > 0.1 {
+			t.Errorf("%s averaged %.3f, want about %.3f", expr, mean, d.Mean())
+		}
+	}
+}
+
+func TestDiceMean(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1d4", 2.5},
+		{"2d6+1", 8},
+		{"2d20kh1", 13.825},
+		{"2d20kl1", 7.175},
+		{"4d6kh3", 12.2446},
+	}
+	for _, tt := range tests {
+		if got := MustParseDice(tt.expr).Mean(); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("%s mean = %.4f, want %.4f", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestDiceReproducible(t *testing.T) {
+	d := MustParseDice("4d6kh3")
+	a := rand.New(rand.NewPCG(1, 2))
+	b := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		if d.Roll(a) != d.Roll(b) {
+			t.Fatal("same seed rolled differently")
+		}
+	}
+}
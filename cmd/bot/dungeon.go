@@ -57,6 +57,9 @@ const (
 	West
 )
 
+// Indexed by direction.
+var DirectionNames = []string{"north", "east", "south", "west"}
+
 // Cast result as state type.
 func RandomState(rng *rand.Rand, cdf []float32) int {
 	for i, p := range cdf {
@@ -68,7 +71,7 @@ func RandomState(rng *rand.Rand, cdf []float32) int {
 }
 
 type Chunk struct {
-	// Index by [X + CHUNKSIZE * Y], (0,0) is top-left
+	// Index by [X + CHUNKSIZEROOT * Y], (0,0) is top-left
 	Rooms [CHUNKSIZE]Room
 }
 
@@ -77,14 +80,25 @@ type Position struct {
 	Y int
 }
 
+// Chance a room has a monster in it.
+const MonsterChance float32 = 0.35
+
 type Room struct {
 	Stairs StairState
 	// 0 1 2 3 = N E S W
 	Doors [4]DoorState
+
+	Monster   bool // A monster lairs here
+	MonsterID int  // Which one, decided when the party first enters
+	Visited   bool
+	Robbed    bool // The monster here was stolen from in its sleep
+	Trap      bool // Springs on the first goblin in
 }
 
 func (r *Room) Randomize(rng *rand.Rand) {
 	r.Stairs = StairState(RandomState(rng, StairCDF))
+	r.Monster = rng.Float32() < MonsterChance
+	r.Trap = rng.Float32() < TrapChance
 }
 
 type Dungeon struct {
@@ -107,21 +121,27 @@ func NewDungeon(seed uint64) *Dungeon {
 		RandState: *rand.NewPCG(seed, SEEDCONST^seed),
 
 		ConnectProbability: 0.25,
+		Level:              1,
 	}
 	d.Rand = rand.New(&d.RandState)
-	d.RoomPos.X = CHUNKSIZE / 2
-	d.RoomPos.Y = CHUNKSIZE / 2
+	d.RoomPos.X = CHUNKSIZEROOT / 2
+	d.RoomPos.Y = CHUNKSIZEROOT / 2
 	d.UpdateChunk()
 
+	// The party needs a moment to get their bearings.
+	d.Room().Monster = false
+	d.Room().Trap = false
+
 	return d
 }
 
 func (d *Dungeon) UpdateChunk() {
-	seed := d.ChunkPos.Hash() ^ d.Seed
+	// Each level below the first is a maze of its own.
+	seed := d.ChunkPos.Hash() ^ d.Seed ^ uint64(d.Level-1)<<56
 	d.RandState.Seed(seed, SEEDCONST^seed)
 	g := RandomConnectedGrid(d.Rand, CHUNKSIZEROOT, d.ConnectProbability)
-	for _, r := range d.Chunk.Rooms {
-		r.Randomize(d.Rand)
+	for i := range d.Chunk.Rooms {
+		d.Chunk.Rooms[i].Randomize(d.Rand)
 	}
 
 	// Randomize doors with interior connections matching the graph
@@ -136,6 +156,91 @@ func (d *Dungeon) UpdateChunk() {
 	// TODO: Randomize outgoing doors for stitching chunks
 }
 
+// The room the party is in.
+func (d *Dungeon) Room() *Room {
+	return &d.Chunk.Rooms[d.RoomPos.X+CHUNKSIZEROOT*d.RoomPos.Y]
+}
+
+// Directions with a door out of the current room, in compass order.
+func (d *Dungeon) Exits() []int {
+	exits := make([]int, 0, 4)
+	for dir, door := range d.Room().Doors {
+		if door != DoorNone {
+			exits = append(exits, dir)
+		}
+	}
+	return exits
+}
+
+// Items left lying in the current room belong to it.
+func (d *Dungeon) RoomOwner() Owner {
+	key := int64(d.Level)<<48 |
+		int64(d.ChunkPos.X&0xff)<<40 | int64(d.ChunkPos.Y&0xff)<<32 |
+		int64(d.RoomPos.X&0xffff)<<16 | int64(d.RoomPos.Y&0xffff)
+	return Owner{Type: OwnerRoom, ID: key}
+}
+
+// Step into the neighboring room. The caller checks for a door.
+func (d *Dungeon) Move(dir int) {
+	d.RoomPos = d.RoomPos.Step(dir)
+}
+
+// Take the stairs down a level, or up one if delta is negative. The party
+// arrives in the middle of the new level, on the stairs leading back, with a
+// moment to get their bearings.
+func (d *Dungeon) ChangeLevel(delta int) {
+	d.Level += delta
+	d.ChunkPos = Position{}
+	d.RoomPos = Position{X: CHUNKSIZEROOT / 2, Y: CHUNKSIZEROOT / 2}
+	d.UpdateChunk()
+
+	room := d.Room()
+	room.Monster = false
+	room.Trap = false
+	room.Stairs = StairUp
+	if delta < 0 {
+		room.Stairs = StairDown
+	}
+}
+
+// Closest room in the chunk with stairs, by steps ignoring walls.
+func (d *Dungeon) NearestStairs() (Position, bool) {
+	best, found := d.RoomPos, false
+	bestDist := 0
+	for i, room := range d.Chunk.Rooms {
+		if room.Stairs == StairNone {
+			continue
+		}
+		p := Position{X: i % CHUNKSIZEROOT, Y: i / CHUNKSIZEROOT}
+		dist := abs(p.X-d.RoomPos.X) + abs(p.Y-d.RoomPos.Y)
+		if !found || dist < bestDist {
+			best, bestDist, found = p, dist, true
+		}
+	}
+	return best, found
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (p Position) Step(dir int) Position {
+	switch dir {
+	case North:
+		p.Y--
+	case East:
+		p.X++
+	case South:
+		p.Y++
+	case West:
+		p.X--
+	}
+	return p
+}
+
 func (p Position) Hash() uint64 {
 	return uint64(p.X)<<32 | uint64(p.Y)
 }
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// What an effect does.
+const (
+	EffectDamage   = "damage"   // Hurt the target. Magic ignores defense
+	EffectHeal     = "heal"     // Restore HP. Gets downed goblins back up
+	EffectBuff     = "buff"     // Raise a stat for some combat rounds
+	EffectSleep    = "sleep"    // The monster skips some turns
+	EffectLight    = "light"    // Nothing catches the party unaware for some rooms
+	EffectTeleport = "teleport" // Whisk the party away to the nearest stairs
+	EffectIdentify = "identify" // Learn what everything the target carries is
+)
+
+var EffectKinds = []string{
+	EffectDamage, EffectHeal, EffectBuff, EffectSleep, EffectLight, EffectTeleport, EffectIdentify,
+}
+
+// Who an effect lands on.
+const (
+	TargetSelf    = "self"
+	TargetAlly    = "ally" // A named member, or the most wounded one
+	TargetMonster = "monster"
+	TargetParty   = "party"
+)
+
+var EffectTargets = []string{TargetSelf, TargetAlly, TargetMonster, TargetParty}
+
+// Stats a buff can raise.
+var BuffStats = []string{"attack", "defense"}
+
+// One thing a spell, item or trap does. Shared by everything that makes
+// magic happen so they all resolve the same way.
+type Effect struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Dice   string `json:"dice"`   // Magnitude, if any
+	Stat   string `json:"stat"`   // Buffs only
+	Rounds int    `json:"rounds"` // Duration of buffs and sleep, rooms for light
+}
+
+func (e Effect) Validate() error {
+	if !slices.Contains(EffectKinds, e.Kind) {
+		return fmt.Errorf("effect: unknown kind %q", e.Kind)
+	}
+	if !slices.Contains(EffectTargets, e.Target) {
+		return fmt.Errorf("effect: unknown target %q", e.Target)
+	}
+	switch e.Kind {
+	case EffectDamage, EffectHeal, EffectBuff:
+		if _, err := ParseDice(e.Dice); err != nil {
+			return fmt.Errorf("effect %s: %w", e.Kind, err)
+		}
+	}
+	if e.Kind == EffectBuff && !slices.Contains(BuffStats, e.Stat) {
+		return fmt.Errorf("effect: cannot buff %q", e.Stat)
+	}
+	if (e.Kind == EffectBuff || e.Kind == EffectSleep || e.Kind == EffectLight) && e.Rounds <= 0 {
+		return fmt.Errorf("effect %s: needs rounds", e.Kind)
+	}
+	return nil
+}
+
+// A temporary stat bonus, undone when it runs out or the fight ends.
+type Buff struct {
+	UserID string
+	Stat   string
+	Amount int
+	Rounds int
+}
+
+// Resolve effects from source, used by the caster uid. Target names a party
+// member for ally effects and may be empty.
+func (g *GameServer) ApplyEffects(source string, uid string, target string, effects []Effect, now time.Time) {
+	d := g.Delve
+	for _, e := range effects {
+		// The party may have been whisked away or fallen.
+		if g.Delve != d {
+			return
+		}
+		g.ApplyEffect(source, uid, target, e, now)
+	}
+}
+
+func (g *GameServer) ApplyEffect(source string, uid string, target string, e Effect, now time.Time) {
+	d := g.Delve
+	if d == nil {
+		return
+	}
+	var magnitude int
+	if e.Dice != "" {
+		dice, err := ParseDice(e.Dice)
+		if err != nil {
+			log.Println("game:", err)
+			return
+		}
+		magnitude = max(0, dice.Roll(g.Rand))
+	}
+
+	if e.Target == TargetMonster {
+		c := d.Combat
+		if c == nil {
+			g.Say(PriorityNormal, "The "+source+" fizzles. There is nothing to aim at.")
+			return
+		}
+		switch e.Kind {
+		case EffectDamage:
+			c.Monster.HP -= magnitude
+			g.Say(PriorityNormal, fmt.Sprintf("The %s takes %d from the %s.", c.Monster.Name, magnitude, source))
+		case EffectSleep:
+			c.Asleep = max(c.Asleep, e.Rounds)
+			g.Say(PriorityNormal, "The "+c.Monster.Name+" falls asleep!")
+		}
+		return
+	}
+
+	switch e.Kind {
+	case EffectLight:
+		d.Light = max(d.Light, e.Rounds)
+		g.Say(PriorityNormal, "The "+source+" lights the way.")
+		return
+	case EffectTeleport:
+		g.Teleport(source, now)
+		return
+	}
+
+	for _, member := range g.EffectTargets(uid, target, e.Target) {
+		pc := g.Party.PlayerCharacters[member]
+		switch e.Kind {
+		case EffectDamage:
+			g.Say(PriorityNormal, fmt.Sprintf("%s takes %d from the %s.", pc.Name, magnitude, source))
+			g.Hurt(member, magnitude)
+		case EffectHeal:
+			g.Heal(member, magnitude)
+			g.Say(PriorityNormal, fmt.Sprintf("%s heals %d.", pc.Name, magnitude))
+		case EffectBuff:
+			if d.Combat == nil {
+				g.Say(PriorityNormal, "The "+source+" only lasts in a fight.")
+				return
+			}
+			g.AddBuff(Buff{UserID: member, Stat: e.Stat, Amount: magnitude, Rounds: e.Rounds})
+			g.Say(PriorityNormal, fmt.Sprintf("%s gains %d %s.", pc.Name, magnitude, e.Stat))
+		case EffectIdentify:
+			g.IdentifyAll(member)
+		}
+	}
+}
+
+// Party members an effect lands on.
+func (g *GameServer) EffectTargets(uid string, target string, to string) []string {
+	switch to {
+	case TargetSelf:
+		return []string{uid}
+	case TargetParty:
+		return g.Targets()
+	}
+
+	if target != "" {
+		name, _ := g.ResolveMember(target)
+		for _, member := range g.Targets() {
+			if g.Party.Name(member) == name {
+				return []string{member}
+			}
+		}
+	}
+
+	// Most wounded member still alive.
+	best, most := uid, -1.0
+	for _, member := range g.Targets() {
+		if w := Wounds(g.Party.PlayerCharacters[member]); w > most {
+			best, most = member, w
+		}
+	}
+	return []string{best}
+}
+
+// Resolve a name among party members, correcting typos.
+func (g *GameServer) ResolveMember(name string) (string, []string) {
+	names := make([]string, 0, len(g.Party.Members))
+	for _, member := range g.Party.Members {
+		names = append(names, g.Party.Name(member))
+	}
+	return FuzzyMatch(strings.TrimPrefix(name, "@"), names)
+}
+
+// Move the party to the nearest stairs, leaving any fight behind.
+func (g *GameServer) Teleport(source string, now time.Time) {
+	d := g.Delve
+	pos, ok := d.NearestStairs()
+	if !ok {
+		g.Say(PriorityNormal, "The "+source+" flickers. There are no stairs nearby.")
+		return
+	} else if pos == d.RoomPos {
+		g.Say(PriorityNormal, "The "+source+" flickers. The party is already at the stairs.")
+		return
+	}
+
+	g.EndCombat()
+	d.Vote, d.Encounter, d.Rest = nil, nil, nil
+	d.RoomPos = pos
+	d.Light = max(0, d.Light-1)
+	m := "The " + source + " whisks the party away to the stairs!"
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+	g.EnterRoom(now)
+}
+
+// Identify everything a goblin carries.
+func (g *GameServer) IdentifyAll(uid string) {
+	pc := g.Party.PlayerCharacters[uid]
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	learned := false
+	for _, item := range items {
+		name := pc.ItemName(item)
+		if g.Identify(uid, item) {
+			g.Say(PriorityNormal, fmt.Sprintf("%s's %s is a %s. %s", pc.Name, name, item.Name, item.Description))
+			learned = true
+		}
+	}
+	if !learned {
+		g.Say(PriorityNormal, pc.Name+" learns nothing new.")
+	}
+}
+
+// Restore HP. A downed goblin with HP again can act.
+func (g *GameServer) Heal(uid string, hp int) {
+	pc := g.Party.PlayerCharacters[uid]
+	if pc.Vitality == Dead || hp <= 0 {
+		return
+	}
+	pc.HP = min(pc.HPMax, pc.HP+hp)
+	if pc.Vitality == Downed && pc.HP > 0 {
+		pc.Vitality = Alive
+		g.Say(PriorityNormal, pc.Name+" is back on their feet.")
+	}
+	g.Party.PlayerCharacters[uid] = pc
+}
+
+func (g *GameServer) AddBuff(b Buff) {
+	g.adjustStat(b.UserID, b.Stat, b.Amount)
+	g.Delve.Combat.Buffs = append(g.Delve.Combat.Buffs, b)
+}
+
+// Count down buffs at the end of a round and undo the ones that ran out.
+func (g *GameServer) TickBuffs() {
+	c := g.Delve.Combat
+	kept := c.Buffs[:0]
+	for _, b := range c.Buffs {
+		b.Rounds--
+		if b.Rounds <= 0 {
+			g.adjustStat(b.UserID, b.Stat, -b.Amount)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	c.Buffs = kept
+}
+
+// Undo every buff when the fight ends.
+func (g *GameServer) ClearBuffs() {
+	c := g.Delve.Combat
+	if c == nil {
+		return
+	}
+	for _, b := range c.Buffs {
+		g.adjustStat(b.UserID, b.Stat, -b.Amount)
+	}
+	c.Buffs = nil
+}
+
+func (g *GameServer) adjustStat(uid string, stat string, amount int) {
+	pc, ok := g.Party.PlayerCharacters[uid]
+	if !ok {
+		return
+	}
+	switch stat {
+	case "attack":
+		pc.Attack.Modifier += amount
+	case "defense":
+		pc.Defense += amount
+	}
+	g.Party.PlayerCharacters[uid] = pc
+}
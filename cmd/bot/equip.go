@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+)
+
+// Equip a carried weapon or armor, putting the old one in the bag. Naming
+// what is already equipped takes it off.
+func (g *GameServer) Equip(cmd Command) {
+	if g.Delve != nil && g.Party.IsMember(cmd.UserID) && !g.CanRummage(cmd.UserID) {
+		return
+	}
+	pc, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	worn := make([]Item, 0, 2)
+	for _, item := range []Item{pc.Weapon, pc.Armor} {
+		if item.ID != EmptyItem {
+			worn = append(worn, item)
+		}
+	}
+	item, _, suggestions := g.ParseItem(pc, append(slices.Clone(items), worn...), cmd.RawArgs)
+	if item.ID == 0 {
+		g.UnknownItem(pc, items, "!equip ", suggestions)
+		return
+	}
+	if _, ok := EquipSlots[item.Type]; !ok {
+		g.Say(PriorityNormal, "@"+pc.Name+" cannot equip the "+pc.ItemName(item)+".")
+		return
+	}
+
+	slot := item.Type
+	wearing := pc.Weapon.ID == item.ID || pc.Armor.ID == item.ID
+	m := pc.Name + " equips the " + pc.ItemName(item) + "."
+	if wearing {
+		err = UnequipItem(g.DB, pc.ID, slot)
+		m = pc.Name + " takes off the " + pc.ItemName(item) + "."
+		if err == nil {
+			item, err = g.LoadItem(EmptyItem)
+		}
+	} else {
+		err = EquipItem(g.DB, pc.ID, item.ID, slot)
+	}
+	if errors.Is(err, ErrCarryFull) {
+		g.Say(PriorityNormal, "@"+pc.Name+" cannot carry any more.")
+		return
+	} else if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	switch slot {
+	case "weapon":
+		pc.Wield(item)
+	case "armor":
+		pc.Wear(item)
+	}
+	if g.Party.IsMember(cmd.UserID) {
+		g.Party.PlayerCharacters[cmd.UserID] = pc
+	}
+	g.Say(PriorityNormal, m)
+}
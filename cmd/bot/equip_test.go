@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEquipSwapsGear(t *testing.T) {
+	g, now := newTestDelve(t)
+	before := g.Party.PlayerCharacters["1"]
+	giveTestItem(t, g, "1", "Rusty Chainmail")
+
+	sendCommand(t, g, "1", "Alice", "!equip chainmail", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Alice equips the Rusty Chainmail.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	pc := g.Party.PlayerCharacters["1"]
+	if pc.Armor.Name != "Rusty Chainmail" || pc.Defense != before.Defense+2 {
+		t.Fatalf("wearing %s with defense %d", pc.Armor.Name, pc.Defense)
+	}
+	if pc.Agility != before.Agility-2 || pc.AgilityMax != before.AgilityMax-2 {
+		t.Fatalf("agility %d/%d, want %d", pc.Agility, pc.AgilityMax, before.AgilityMax-2)
+	}
+
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil || len(items) != 1 || items[0].Name != "Snotty Rags" {
+		t.Fatalf("old armor not in the bag: %v %v", items, err)
+	}
+	loaded, err := g.LoadCharacter("1")
+	if err != nil || loaded.Armor.Name != "Rusty Chainmail" || loaded.Agility != pc.Agility {
+		t.Fatalf("equipment not saved: %+v %v", loaded.Armor, err)
+	}
+}
+
+func TestEquipChecksType(t *testing.T) {
+	g, now := newTestDelve(t)
+	giveTestItem(t, g, "1", "Potion of Grom's Blood")
+
+	sendCommand(t, g, "1", "Alice", "!equip potion", now)
+	if chat := drainChat(g); !strings.Contains(chat, "cannot equip") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if g.Party.PlayerCharacters["1"].Weapon.Name != StartingWeapon {
+		t.Fatal("weapon changed")
+	}
+}
+
+func TestUnequip(t *testing.T) {
+	g, now := newTestDelve(t)
+
+	sendCommand(t, g, "1", "Alice", "!equip shank", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Alice takes off the Rusty Shank.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	pc := g.Party.PlayerCharacters["1"]
+	if pc.Weapon.ID != EmptyItem || pc.Attack != Fists {
+		t.Fatalf("still armed with %s %s", pc.Weapon.Name, pc.Attack)
+	}
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil || len(items) != 1 || items[0].Name != StartingWeapon {
+		t.Fatalf("shank not in the bag: %v %v", items, err)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!equip shank", now)
+	if pc := g.Party.PlayerCharacters["1"]; pc.Weapon.Name != StartingWeapon {
+		t.Fatal("could not take the shank back up")
+	}
+}
+
+func TestShootNeedsBow(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	sendCommand(t, g, "1", "Alice", "!shoot", now)
+	if chat := drainChat(g); !strings.Contains(chat, "has no ranged weapon") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	bow, err := g.LoadItem(giveTestItem(t, g, "1", "Bone Bow"))
+	if err != nil || !bow.Ranged {
+		t.Fatalf("bow is not ranged: %v", err)
+	}
+	pc := g.Party.PlayerCharacters["1"]
+	pc.Wield(bow)
+	g.Party.PlayerCharacters["1"] = pc
+
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	sendCommand(t, g, "1", "Alice", "!shoot", now)
+	if chat := drainChat(g); strings.Contains(chat, "has no ranged weapon") {
+		t.Fatalf("bow was not used:\n%s", chat)
+	}
+}
+
+func TestInspectSheet(t *testing.T) {
+	g, now := newTestDelve(t)
+
+	sendCommand(t, g, "1", "Alice", "!inspect bob", now)
+	chat := drainChat(g)
+	if !strings.Contains(chat, "Bob | Lv 1 | HP ") || !strings.Contains(chat, "Rusty Shank 1d4, Snotty Rags +0") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Edit distance between a and b, ignoring case. Counts insertions,
+// deletions, substitutions and swaps of neighboring letters, the usual typos.
+//
+// https://en.wikipedia.org/wiki/Damerau%E2%80%93Levenshtein_distance#Optimal_string_alignment_distance
+func EditDistance(a string, b string) int {
+	s := []rune(strings.ToLower(a))
+	t := []rune(strings.ToLower(b))
+
+	// Three rolling rows: two back, previous, current.
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(t)]
+}
+
+// Typos tolerated in an input of n letters. Short words get little slack so
+// "!e" does not turn into "!equip".
+func FuzzyThreshold(n int) int {
+	switch {
+	case n <= 2:
+		return 0
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	}
+	return 3
+}
+
+// Shortest input that may match a longer name by containment.
+const FuzzyMinContains = 4
+
+// Resolve imperfect input to one of the candidates. In order of preference:
+// an exact match ignoring case, the only candidate with a word matching the
+// input, the only candidate containing the input, or the only candidate
+// within FuzzyThreshold typos.
+//
+// Returns the match when confident. Otherwise returns the equally good
+// candidates worth suggesting, which is empty if nothing is close.
+func FuzzyMatch(input string, candidates []string) (string, []string) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", nil
+	}
+	lower := strings.ToLower(input)
+
+	for _, c := range candidates {
+		if strings.ToLower(c) == lower {
+			return c, nil
+		}
+	}
+
+	// Short words like the "jar" in "humming jar" are too short to contain.
+	wordMatches := make([]string, 0, 2)
+	for _, c := range candidates {
+		if slices.Contains(strings.Fields(strings.ToLower(c)), lower) {
+			wordMatches = append(wordMatches, c)
+		}
+	}
+	if len(wordMatches) == 1 {
+		return wordMatches[0], nil
+	} else if len(wordMatches) > 1 {
+		return "", wordMatches
+	}
+
+	if len([]rune(input)) >= FuzzyMinContains {
+		containing := make([]string, 0, 2)
+		for _, c := range candidates {
+			if strings.Contains(strings.ToLower(c), lower) {
+				containing = append(containing, c)
+			}
+		}
+		if len(containing) == 1 {
+			return containing[0], nil
+		} else if len(containing) > 1 {
+			return "", containing
+		}
+	}
+
+	threshold := FuzzyThreshold(len([]rune(input)))
+	best := threshold + 1
+	closest := make([]string, 0, 2)
+	for _, c := range candidates {
+		d := EditDistance(input, c)
+		if d < best {
+			best = d
+			closest = closest[:0]
+		}
+		if d == best {
+			closest = append(closest, c)
+		}
+	}
+
+	if len(closest) == 1 {
+		return closest[0], nil
+	}
+	return "", closest
+}
+
+// Split "thing [target]" where thing is one of names, correcting typos. The
+// target is the last word if the whole input names nothing. Returns
+// suggestions for the thing if it is unclear.
+func SplitTarget(raw string, names []string) (string, string, []string) {
+	match, suggestions := FuzzyMatch(raw, names)
+	if match != "" {
+		return match, "", nil
+	}
+
+	words := strings.Fields(raw)
+	if len(words) > 1 {
+		last := len(words) - 1
+		match, _ = FuzzyMatch(strings.Join(words[:last], " "), names)
+		if match != "" {
+			return match, words[last], nil
+		}
+	}
+
+	return "", "", suggestions
+}
+
+// Reply to a player whose input matched several things equally well.
+func (g *GameServer) DidYouMean(cmd Command, prefix string, suggestions []string) {
+	if len(suggestions) == 0 {
+		return
+	}
+	options := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		options[i] = prefix + s
+	}
+	last := len(options) - 1
+	list := options[last]
+	if last > 0 {
+		list = strings.Join(options[:last], ", ") + " or " + options[last]
+	}
+	g.Say(PriorityNormal, "@"+cmd.Name()+" did you mean "+list+"?")
+}
+
+// Every command verb in the Command table.
+func (g *GameServer) CommandNames() []string {
+	rows, err := g.Query[QueryCommandList].Query()
+	if err != nil {
+		log.Println("game:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	names := make([]string, 0, 16)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println("game:", err)
+			return names
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Look up a command verb, correcting typos. Returns the command and its
+// type, or suggestions if the verb is unknown or ambiguous.
+func (g *GameServer) ResolveCommand(verb string) (string, string, []string) {
+	var command, commandType string
+
+	err := g.Query[QueryCommand].QueryRow(verb).Scan(&command, &commandType)
+	if err == nil {
+		return command, commandType, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println("game:", err)
+		return "", "", nil
+	}
+
+	match, suggestions := FuzzyMatch(verb, g.CommandNames())
+	if match == "" {
+		return "", "", suggestions
+	}
+	err = g.Query[QueryCommand].QueryRow(match).Scan(&command, &commandType)
+	if err != nil {
+		log.Println("game:", err)
+		return "", "", nil
+	}
+	return command, commandType, nil
+}
+
+// Every item name in the Item table except the empty placeholder.
+func (g *GameServer) ItemNames() []string {
+	rows, err := g.Query[QueryItemNames].Query()
+	if err != nil {
+		log.Println("game:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	names := make([]string, 0, 16)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println("game:", err)
+			return names
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func (g *GameServer) ResolveItem(name string) (string, []string) {
+	return FuzzyMatch(name, g.ItemNames())
+}
+
+// Resolve a player by name among everyone the game has heard from. A
+// leading @ from chat mentions is ignored.
+func (g *GameServer) ResolvePlayer(name string) (string, []string) {
+	names := make([]string, 0, len(g.KnownPlayers))
+	for n := range g.KnownPlayers {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return FuzzyMatch(strings.TrimPrefix(name, "@"), names)
+}
+
+func ResolveDirection(name string) (string, []string) {
+	switch strings.ToLower(name) {
+	case "n":
+		return "north", nil
+	case "e":
+		return "east", nil
+	case "s":
+		return "south", nil
+	case "w":
+		return "west", nil
+	case "h":
+		return "home", nil
+	}
+	return FuzzyMatch(name, append(slices.Clone(DirectionNames), "home"))
+}
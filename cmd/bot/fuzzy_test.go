@@ -0,0 +1,110 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"join", "join", 0},
+		{"JOIN", "join", 0},
+		{"jion", "join", 1},
+		{"jon", "join", 1},
+		{"joinn", "join", 1},
+		{"atack", "attack", 1},
+		{"inspetc", "inspect", 1},
+		{"", "sneak", 5},
+		{"north", "south", 2},
+	}
+	for _, tt := range tests {
+		if got := EditDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	commands := []string{"attack", "inspect", "join", "sneak"}
+	items := []string{"Potion of Grom's Blood", "Rusty Shank", "Snotty Rags"}
+
+	tests := []struct {
+		input      string
+		candidates []string
+		want       string
+		suggest    []string
+	}{
+		{"join", commands, "join", nil},
+		{"Jion", commands, "join", nil},
+		{"atack", commands, "attack", nil},
+		{"snek", commands, "sneak", nil},
+		{"uptime", commands, "", nil},
+		{"x", commands, "", nil},
+		{"rusty shnak", items, "Rusty Shank", nil},
+		{"grom", items, "Potion of Grom's Blood", nil},
+		{"Rags", items, "Snotty Rags", nil},
+		{"sh", items, "", nil},
+		{"st", []string{"north", "east", "south", "west"}, "", nil},
+		{"nort", []string{"north", "east", "south", "west"}, "north", nil},
+		{"est", []string{"east", "west"}, "", []string{"east", "west"}},
+		{"snot", []string{"snotty rag", "snotling"}, "", []string{"snotty rag", "snotling"}},
+		{"snot", []string{"snot rag", "snotling"}, "snot rag", nil},
+		{"jar", []string{"humming jar", "jam"}, "humming jar", nil},
+		{"jar", []string{"humming jar", "clay jar"}, "", []string{"humming jar", "clay jar"}},
+	}
+	for _, tt := range tests {
+		got, suggest := FuzzyMatch(tt.input, tt.candidates)
+		if got != tt.want || !slices.Equal(suggest, tt.suggest) {
+			t.Errorf("FuzzyMatch(%q) = %q %v, want %q %v",
+				tt.input, got, suggest, tt.want, tt.suggest)
+		}
+	}
+}
+
+func TestResolveDirection(t *testing.T) {
+	for input, want := range map[string]string{
+		"n": "north", "W": "west", "soth": "south", "hmoe": "home",
+	} {
+		if got, _ := ResolveDirection(input); got != want {
+			t.Errorf("ResolveDirection(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestHandleCommandsFuzzy(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+
+	send := func(text string) string {
+		sendCommand(t, g, "1", "Alice", text, time.Now())
+		m, _ := g.MessagesOut.Pop(time.Now())
+		return m
+	}
+
+	if m := send("!jion"); !strings.Contains(m, "Alice joined the party!") {
+		t.Fatalf("typo was not corrected: %q", m)
+	}
+
+	g.Query[QueryCommandList].Close()
+	g.Query[QueryCommandList], _ = g.DB.Prepare(`SELECT 'sneer' UNION SELECT 'sneak'`)
+	if m := send("!sneek"); m != "@Alice did you mean !sneak or !sneer?" {
+		t.Fatalf("ambiguous command got %q", m)
+	}
+
+	if m := send("!uptime"); m != "" {
+		t.Fatalf("unrelated command should be ignored, got %q", m)
+	}
+
+	if got, _ := g.ResolveItem("shank"); got != "Rusty Shank" {
+		t.Fatalf("ResolveItem found %q", got)
+	}
+	if got, _ := g.ResolvePlayer("@alcie"); got != "Alice" {
+		t.Fatalf("ResolvePlayer found %q", got)
+	}
+}
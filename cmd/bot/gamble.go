@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// The house's cut of every game unless configured otherwise.
+	DefaultHouseEdge = 0.05
+
+	// Goblins may bet this much per level.
+	BetPerLevel = 20
+
+	// How long a goblin waits between bets.
+	WagerCooldown = 10 * time.Second
+
+	// How often the lottery is drawn.
+	LotteryWait = time.Hour
+)
+
+// Largest bet a goblin of the given level may place.
+func MaxBet(level int) int {
+	return BetPerLevel * max(1, level)
+}
+
+// The next draw after now. Draws line up with the clock so a restart keeps
+// the schedule.
+func NextDraw(now time.Time, wait time.Duration) time.Time {
+	return now.Truncate(wait).Add(wait)
+}
+
+// Parse and check a bet, replying if it is no good. Returns the goblin
+// placing it and the bet, which is zero if it was refused.
+func (g *GameServer) TakeBet(cmd Command, game string, now time.Time) (Character, int) {
+	pc, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return pc, 0
+	}
+	if last, ok := g.LastWager[cmd.UserID]; ok && now.Sub(last) < WagerCooldown {
+		wait := WagerCooldown - now.Sub(last)
+		g.Say(PriorityNormal, fmt.Sprintf("@%s catch your breath for %ds.", pc.Name, int(wait.Seconds()+0.5)))
+		return pc, 0
+	}
+	limit := MaxBet(pc.Level)
+	bet, err := strconv.Atoi(cmd.Arg(0))
+	if err != nil || bet <= 0 || bet > limit {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s bet 1 to %d shinies: !%s [bet]", pc.Name, limit, game))
+		return pc, 0
+	}
+	return pc, bet
+}
+
+// Log the bet and settle the goblin's shinies.
+func (g *GameServer) Wager(pc Character, game string, bet int, payout int, now time.Time) bool {
+	err := PlaceWager(g.DB, pc.ID, game, bet, payout, now)
+	if errors.Is(err, ErrTooPoor) {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s does not have %d shinies.", pc.Name, bet))
+		return false
+	} else if err != nil {
+		log.Println("game:", err)
+		return false
+	}
+	g.LastWager[pc.UserID] = now
+	return true
+}
+
+// Bet against the house. The goblin wins even money a little less than
+// half the time.
+func (g *GameServer) Dice(cmd Command, now time.Time) {
+	pc, bet := g.TakeBet(cmd, GameDice, now)
+	if bet == 0 {
+		return
+	}
+	won := g.Rand.Float64() < (1-g.HouseEdge)/2
+	payout := 0
+	if won {
+		payout = 2 * bet
+	}
+	if !g.Wager(pc, GameDice, bet, payout, now) {
+		return
+	}
+
+	m := fmt.Sprintf("%s throws the bones and loses %d shinies.", pc.Name, bet)
+	if won {
+		m = fmt.Sprintf("%s throws the bones and wins %d shinies!", pc.Name, bet)
+	}
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+}
+
+// Buy lottery tickets, one per shiny. The pot goes to one ticket at the
+// next draw.
+func (g *GameServer) Lottery(cmd Command, now time.Time) {
+	if cmd.Arg(0) == "" {
+		pot, err := LotteryPot(g.DB)
+		if err != nil {
+			log.Println("game:", err)
+			return
+		}
+		if g.LotteryDeadline.IsZero() {
+			g.LotteryDeadline = NextDraw(now, g.LotteryWait)
+		}
+		wait := g.LotteryDeadline.Sub(now).Round(time.Minute)
+		g.Say(PriorityNormal, fmt.Sprintf("The pot is %d shinies, drawn in %s. !lottery [bet]", pot, wait))
+		return
+	}
+	pc, bet := g.TakeBet(cmd, GameLottery, now)
+	if bet == 0 || !g.Wager(pc, GameLottery, bet, 0, now) {
+		return
+	}
+	g.Say(PriorityNormal, fmt.Sprintf("%s buys %d lottery tickets.", pc.Name, bet))
+}
+
+// Draw the lottery when it is due and set the next draw.
+func (g *GameServer) UpdateLottery(now time.Time) {
+	if g.LotteryDeadline.IsZero() {
+		g.LotteryDeadline = NextDraw(now, g.LotteryWait)
+		return
+	}
+	if now.Before(g.LotteryDeadline) {
+		return
+	}
+	g.LotteryDeadline = NextDraw(now, g.LotteryWait)
+
+	name, winnings, err := DrawLottery(g.DB, g.Rand, g.HouseEdge)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	} else if name == "" {
+		return
+	}
+	m := fmt.Sprintf("%s wins the lottery and %d shinies!", name, winnings)
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+}
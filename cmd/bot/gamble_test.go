@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A goblin in town with shinies to spend.
+func newTestGambler(t *testing.T, shinies int) (*GameServer, Character, time.Time) {
+	t.Helper()
+	g := newTestGameServer(t)
+	t.Cleanup(func() {
+		CloseQuery(g.Query)
+		g.DB.Close()
+	})
+	g.Rand = rand.New(rand.NewPCG(1, 2))
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	sendCommand(t, g, "1", "Alice", "!lottery", now)
+	drainChat(g)
+	pc, err := g.LoadCharacter("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AwardCharacter(g.DB, pc.ID, shinies, 0); err != nil {
+		t.Fatal(err)
+	}
+	return g, pc, now
+}
+
+func countWagers(t *testing.T, g *GameServer) (n int, bets int, payouts int) {
+	t.Helper()
+	err := g.DB.QueryRow("SELECT COUNT(*), COALESCE(SUM(bet), 0), COALESCE(SUM(payout), 0) FROM Wager").
+		Scan(&n, &bets, &payouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n, bets, payouts
+}
+
+func TestDiceHouseEdge(t *testing.T) {
+	g, pc, now := newTestGambler(t, 10_000)
+	g.HouseEdge = 0.2
+
+	const rounds = 400
+	for range rounds {
+		now = now.Add(WagerCooldown)
+		sendCommand(t, g, "1", "Alice", "!dice 10", now)
+	}
+	drainChat(g)
+	var wins int
+	if err := g.DB.QueryRow("SELECT COUNT(*) FROM Wager WHERE payout > 0").Scan(&wins); err != nil {
+		t.Fatal(err)
+	}
+	if want := rounds * (1 - g.HouseEdge) / 2; float64(wins) < want-40 || float64(wins) > want+40 {
+		t.Fatalf("won %d of %d, want about %.0f", wins, rounds, want)
+	}
+
+	n, bets, payouts := countWagers(t, g)
+	shinies, _ := g.Shinies(pc)
+	if n != rounds || shinies != 10_000-bets+payouts || payouts != 20*wins {
+		t.Fatalf("%d wagers, %d bet, %d paid, %d shinies left", n, bets, payouts, shinies)
+	}
+
+	g.HouseEdge = 1
+	for range 20 {
+		now = now.Add(WagerCooldown)
+		sendCommand(t, g, "1", "Alice", "!dice 10", now)
+	}
+	if _, _, more := countWagers(t, g); more != payouts {
+		t.Fatal("beat a house that always wins")
+	}
+}
+
+func TestBetLimitsAndCooldown(t *testing.T) {
+	g, pc, now := newTestGambler(t, 30)
+
+	sendCommand(t, g, "1", "Alice", "!dice 21", now)
+	if chat := drainChat(g); !strings.Contains(chat, "bet 1 to 20 shinies") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	sendCommand(t, g, "1", "Alice", "!dice lots", now)
+	sendCommand(t, g, "1", "Alice", "!dice 1", now)
+	sendCommand(t, g, "1", "Alice", "!dice 1", now.Add(WagerCooldown/2))
+	if chat := drainChat(g); !strings.Contains(chat, "catch your breath for 5s") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	if _, err := g.DB.Exec("UPDATE Character SET shinies = 0 WHERE id = ?", pc.ID); err != nil {
+		t.Fatal(err)
+	}
+	sendCommand(t, g, "1", "Alice", "!dice 5", now.Add(WagerCooldown))
+	if chat := drainChat(g); !strings.Contains(chat, "does not have 5 shinies") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if n, _, _ := countWagers(t, g); n != 1 {
+		t.Fatalf("logged %d wagers, want 1", n)
+	}
+}
+
+func TestLotteryDraw(t *testing.T) {
+	g, alice, now := newTestGambler(t, 20)
+	sendCommand(t, g, "2", "Bob", "!lottery", now)
+	bob, _ := g.LoadCharacter("2")
+	if err := AwardCharacter(g.DB, bob.ID, 20, 0); err != nil {
+		t.Fatal(err)
+	}
+	g.Update(now)
+	if want := NextDraw(now, LotteryWait); !g.LotteryDeadline.Equal(want) {
+		t.Fatalf("next draw at %v, want %v", g.LotteryDeadline, want)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!lottery 20", now)
+	sendCommand(t, g, "2", "Bob", "!lottery 20", now)
+	sendCommand(t, g, "1", "Alice", "!lottery", now)
+	if chat := drainChat(g); !strings.Contains(chat, "The pot is 40 shinies") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	g.Update(g.LotteryDeadline)
+	chat := drainChat(g)
+	if !strings.Contains(chat, "wins the lottery and 38 shinies!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	a, _ := g.Shinies(alice)
+	b, _ := g.Shinies(bob)
+	if a+b != 38 || (a != 38 && b != 38) {
+		t.Fatalf("Alice has %d and Bob %d shinies", a, b)
+	}
+	if pot, _ := LotteryPot(g.DB); pot != 0 {
+		t.Fatalf("%d shinies left in the pot", pot)
+	}
+	if _, _, payouts := countWagers(t, g); payouts != 38 {
+		t.Fatalf("logged %d paid out", payouts)
+	}
+}
+
+func TestLotteryPaysTheLiving(t *testing.T) {
+	g, alice, now := newTestGambler(t, 20)
+	sendCommand(t, g, "1", "Alice", "!lottery 20", now)
+	if err := KillCharacter(g.DB, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	sendCommand(t, g, "1", "Alice", "!lottery", now)
+	reborn, err := g.LoadCharacter("1")
+	if err != nil || reborn.ID == alice.ID {
+		t.Fatalf("no new goblin: %+v %v", reborn, err)
+	}
+	drainChat(g)
+
+	g.Update(now)
+	g.Update(g.LotteryDeadline)
+	if chat := drainChat(g); !strings.Contains(chat, "wins the lottery and 19 shinies!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if a, _ := g.Shinies(alice); a != 0 {
+		t.Fatalf("dead goblin was paid %d shinies", a)
+	}
+	if b, _ := g.Shinies(reborn); b != 19 {
+		t.Fatalf("living goblin has %d shinies, want 19", b)
+	}
+}
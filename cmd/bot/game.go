@@ -2,8 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,14 +15,22 @@ import (
 )
 
 // TODO: Game Loop ->
-//  1. New Game: Players !join to fill the dungeon party
-//  2. Start:    After 10 seconds or when full, start crawl
 //  3. Crawl:    Dungeon is generated procedurally one room at a time
 //               Players may explore at the risk of deadly traps and combat
 //  4. Combat:   In combat play proceeds round by round.
 
 // Commonly modified values are cached in Character
 type Character struct {
+	ID     int
+	UserID string
+	Name   string
+	Level  int
+
+	Experience int
+	Sign       string // Birth sign name
+
+	Vitality
+
 	Might   int
 	Agility int
 	Will    int
@@ -30,37 +42,90 @@ type Character struct {
 	HP    int
 	HPMax int
 
-	AttackDie     int
-	NumAttackDice int
-	AttackBonus   int
+	Attack Dice
 
 	Defense int
+
+	Weapon Item
+	Armor  Item
+
+	Spells   []Spell
+	Prepared int // Spell ID, zero if none
+	Readied  int // Item ID, zero if none
+
+	Known map[int]bool // Item IDs identified
+}
+
+// Damage dealt without a weapon.
+var Fists = MustParseDice("1d2")
+
+// Take up a weapon, recomputing attack and Agility.
+func (c *Character) Wield(weapon Item) {
+	c.Agility += weapon.AgilityMod - c.Weapon.AgilityMod
+	c.AgilityMax += weapon.AgilityMod - c.Weapon.AgilityMod
+	c.Weapon = weapon
+	c.Attack = Fists
+	if weapon.Attack.Count > 0 {
+		c.Attack = weapon.Attack
+	}
+}
+
+// Put on armor, recomputing Defense and Agility.
+func (c *Character) Wear(armor Item) {
+	c.Agility += armor.AgilityMod - c.Armor.AgilityMod
+	c.AgilityMax += armor.AgilityMod - c.Armor.AgilityMod
+	c.Defense += armor.Defense - c.Armor.Defense
+	c.Armor = armor
 }
 
 type Party struct {
 	PlayersMax int
 
+	Leader  string   // User ID
+	Members []string // User IDs in join order
+
 	PlayerCharacters map[string]Character
 }
 
 type GameServer struct {
-	CommandsIn chan string // For getting commands from bot
+	CommandsIn chan Command // For getting commands from bot
 	Interrupt  chan os.Signal
 	Shutdown   chan struct{}
 
-	MessagesOut chan string // For sending messages to bot
+	MessagesOut *Outbox // For sending messages to bot
 
 	DB *sql.DB
 
 	Query []*sql.Stmt
 
+	Rand *rand.Rand
+
+	Phase Phase
 	Party
+	Delve *Delve // Nil unless the party is in the dungeon
+
+	LobbyWait     time.Duration
+	LobbyDeadline time.Time
+	VoteWait      time.Duration
+	TurnWait      time.Duration
+	RestWait      time.Duration
+
+	HouseEdge       float64 // Fraction of every bet the house keeps on average
+	LastWager       map[string]time.Time
+	LotteryWait     time.Duration
+	LotteryDeadline time.Time
+
+	KnownPlayers map[string]string // Display name -> user ID of everyone seen
 
 	TickRate time.Duration
 }
 
 func NewGameServer() *GameServer {
-	db, err := NewGameDB("game.db")
+	return NewGameServerWithDB(GetPathPrefix() + "db/game.db")
+}
+
+func NewGameServerWithDB(path string) *GameServer {
+	db, err := OpenGameDB(path)
 	if err != nil {
 		log.Fatalln("db:", err)
 	}
@@ -68,79 +133,230 @@ func NewGameServer() *GameServer {
 	if err != nil {
 		log.Fatalln("db:", err)
 	}
+	seed := uint64(time.Now().UnixNano())
 	return &GameServer{
-		CommandsIn: make(chan string, 32),
+		CommandsIn: make(chan Command, 32),
 		Interrupt:  make(chan os.Signal, 1),
 		Shutdown:   make(chan struct{}),
 
+		MessagesOut: NewOutbox(),
+
 		DB:    db,
 		Query: q,
 
+		Rand: rand.New(rand.NewPCG(seed, SEEDCONST^seed)),
+
 		Party: Party{
 			PlayersMax:       10,
+			Members:          make([]string, 0, 10),
 			PlayerCharacters: make(map[string]Character),
 		},
 
+		LobbyWait: LobbyWait,
+		VoteWait:  VoteWait,
+		TurnWait:  TurnWait,
+		RestWait:  RestWait,
+
+		HouseEdge:   DefaultHouseEdge,
+		LastWager:   make(map[string]time.Time),
+		LotteryWait: LotteryWait,
+
+		KnownPlayers: make(map[string]string),
+
 		TickRate: 32 * time.Millisecond,
 	}
 }
 
-func (g *GameServer) EnsureRegistered(uid string) error {
-	_, err := g.Query[QueryUser].Query(uid)
+// Queue a chat message. Never blocks the game tick.
+func (g *GameServer) Say(p Priority, m string) {
+	g.MessagesOut.Push(p, m)
+}
+
+// Create a character for users seen for the first time, or whose last
+// goblin died.
+func (g *GameServer) EnsureRegistered(uid string, name string) error {
+	var id int
+	err := g.Query[QueryUser].QueryRow(uid).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("game: New goblin", name, uid)
+		return CreateCharacter(g.DB, g.Rand, uid, name)
+	}
+	return err
+}
+
+func (g *GameServer) LoadCharacter(uid string) (Character, error) {
+	var weaponID, armorID int
+	c := Character{UserID: uid}
+	err := g.Query[QueryCharacter].QueryRow(uid).Scan(
+		&c.ID, &c.Name, &c.Level, &c.Experience, &c.Sign,
+		&c.Might, &c.Agility, &c.Will, &c.HP,
+		&weaponID, &armorID,
+	)
+	if err != nil {
+		return c, fmt.Errorf("load character %s: %w", uid, err)
+	}
+	c.MightMax, c.AgilityMax, c.WillMax, c.HPMax = c.Might, c.Agility, c.Will, c.HP
+	weapon, err := g.LoadItem(weaponID)
+	if err != nil {
+		return c, fmt.Errorf("load character %s: %w", uid, err)
+	}
+	armor, err := g.LoadItem(armorID)
 	if err != nil {
-		log.Println("USER", uid, "DOES NOT EXIST")
-		CreateCharacter(g.DB, uid)
-	} else {
-		log.Println("USER", uid, "EXISTS")
+		return c, fmt.Errorf("load character %s: %w", uid, err)
 	}
+	c.Wield(weapon)
+	c.Wear(armor)
+	c.Spells, err = g.KnownSpells(c.ID)
+	if err != nil {
+		return c, fmt.Errorf("load character %s: %w", uid, err)
+	}
+	c.Known, err = g.KnownItems(c.ID)
+	if err != nil {
+		return c, fmt.Errorf("load character %s: %w", uid, err)
+	}
+	return c, nil
+}
 
-	return nil
+// A party member's character as it stands, or anyone else's from the DB.
+func (g *GameServer) Character(uid string) (Character, error) {
+	if pc, ok := g.Party.PlayerCharacters[uid]; ok {
+		return pc, nil
+	}
+	return g.LoadCharacter(uid)
 }
 
-// ASSUME cmdString has shape "<UserID> <Username> <Cmd> <Cmd Options>..."
-// ASSUME commands are authorized by the bot
+// ASSUME commands are authorized by the transport
 // Returns true to continue, false to shutdown
-func (g *GameServer) HandleCommands() bool {
-	var command, commandType string
-
+func (g *GameServer) HandleCommands(now time.Time) bool {
 	for len(g.CommandsIn) > 0 {
-		cmdString := <-g.CommandsIn
+		cmd := <-g.CommandsIn
 
-		if cmdString == "shutdown" {
+		if cmd.Verb == "shutdown" {
 			return false
 		}
 
-		parts := strings.Split(cmdString, " ")
-		uid := parts[0]
-		uname := parts[1]
-		cmd := parts[2:]
-
-		g.EnsureRegistered(uid)
-
-		err := g.Query[QueryCommand].QueryRow(cmd[0]).Scan(&command, &commandType)
+		err := g.EnsureRegistered(cmd.UserID, cmd.Name())
 		if err != nil {
 			log.Println("game:", err)
 			continue
 		}
+		g.KnownPlayers[cmd.Name()] = cmd.UserID
+
+		command, commandType, suggestions := g.ResolveCommand(cmd.Verb)
+		if command == "" {
+			g.DidYouMean(cmd, "!", suggestions)
+			continue
+		}
+		cmd.Verb = command
+		if commandType == "town" && !g.InTown(cmd.UserID) {
+			g.Say(PriorityNormal, "@"+cmd.Name()+" that will have to wait until Goblin Town.")
+			continue
+		}
 
 		switch command {
 		case "join":
-			m := "game: " + uname + " joined the party!"
-			log.Println(m)
-			g.MessagesOut <- m
+			g.Join(cmd, now)
+		case "leave":
+			g.Leave(cmd)
+		case "begin":
+			g.BeginCommand(cmd, now)
+		case "north", "east", "south", "west", VoteDown, VoteUp, VoteHome:
+			g.CastVote(cmd, now)
+		case "rest":
+			g.StartRest(cmd, now)
+		case "sneak", "steal":
+			if g.Delve != nil && g.Delve.Encounter != nil {
+				g.ChooseApproach(cmd, now)
+			}
+		case "prepare", "cast", "ready", "use":
+			if g.Delve != nil && g.Delve.Combat != nil {
+				g.ChooseAction(cmd, now)
+			} else if g.Delve != nil && slices.Contains(g.Standing(), cmd.UserID) {
+				g.ResolveAction(cmd.UserID, Choice{
+					Action: Action(slices.Index(ActionNames, command)),
+					Arg:    cmd.RawArgs,
+				}, now)
+			}
+		case "attack", "shoot", "flee", "taunt":
+			if g.Delve != nil && g.Delve.Encounter != nil && command == "attack" {
+				g.ChooseApproach(cmd, now)
+				break
+			}
+			g.ChooseAction(cmd, now)
+		case "inventory":
+			g.Inspect(cmd.UserID, cmd.UserID)
+		case "search":
+			g.Search(cmd)
+		case "grab":
+			g.Grab(cmd)
+		case "drop":
+			g.Drop(cmd)
+		case "give":
+			g.Give(cmd)
+		case "equip":
+			g.Equip(cmd)
+		case "shop":
+			g.Shop(cmd, now)
+		case "buy":
+			g.Buy(cmd, now)
+		case "sell":
+			g.Sell(cmd, now)
+		case "dice":
+			g.Dice(cmd, now)
+		case "lottery":
+			g.Lottery(cmd, now)
 		case "inspect":
-			opts := cmd[1:]
-			if len(opts) < 1 {
+			if cmd.Arg(0) == "" {
+				break
+			}
+			name, suggestions := g.ResolvePlayer(cmd.RawArgs)
+			if name == "" {
+				g.DidYouMean(cmd, "!inspect ", suggestions)
 				break
 			}
-			otheruser := opts[0]
-			log.Println("game:", uname, "is inspecting", otheruser)
+			log.Println("game:", cmd.Name(), "is inspecting", name)
+			g.Inspect(cmd.UserID, g.KnownPlayers[name])
 		}
 	}
 
 	return true
 }
 
+// Show a goblin's sheet and what they carry, or just what they carry when
+// looking at oneself. Items go by the names the viewer knows them by.
+func (g *GameServer) Inspect(viewerUID string, uid string) {
+	viewer, err := g.Character(viewerUID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	c, err := g.Character(uid)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if uid != viewerUID {
+		g.Say(PriorityNormal, viewer.Sheet(c))
+	}
+	g.ShowInventory(viewer, c)
+}
+
+// One line summary of a goblin as the viewer sees them.
+func (viewer Character) Sheet(c Character) string {
+	gear := make([]string, 0, 2)
+	if c.Weapon.ID != EmptyItem {
+		gear = append(gear, viewer.ItemName(c.Weapon)+" "+c.Weapon.Attack.String())
+	}
+	if c.Armor.ID != EmptyItem {
+		gear = append(gear, fmt.Sprintf("%s %+d", viewer.ItemName(c.Armor), c.Armor.Defense))
+	}
+	if len(gear) == 0 {
+		gear = append(gear, "no gear")
+	}
+	return fmt.Sprintf("%s | Lv %d | HP %d/%d | Mgt %d Agi %d Wil %d | %s",
+		c.Name, c.Level, c.HP, c.HPMax, c.Might, c.Agility, c.Will, strings.Join(gear, ", "))
+}
+
 func (g *GameServer) Run() {
 	defer close(g.Shutdown)
 	defer g.DB.Close()
@@ -153,8 +369,9 @@ func (g *GameServer) Run() {
 
 	for alive {
 		select {
-		case <-gameTicker.C:
-			alive = g.HandleCommands()
+		case now := <-gameTicker.C:
+			alive = g.HandleCommands(now)
+			g.Update(now)
 		case <-g.Interrupt:
 			log.Println("game: Interrupt received.")
 			alive = false
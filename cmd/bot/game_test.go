@@ -1,7 +1,10 @@
 package main
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewGameServer(t *testing.T) {
@@ -10,3 +13,35 @@ func TestNewGameServer(t *testing.T) {
 		t.Fatal("Nil server. Failed to create game server.")
 	}
 }
+
+// A game server backed by a fresh database that is removed after the test.
+func newTestGameServer(t *testing.T) *GameServer {
+	t.Helper()
+	return NewGameServerWithDB(filepath.Join(t.TempDir(), "game.db"))
+}
+
+// Feed one chat line to the game as user uid and handle it.
+func sendCommand(t *testing.T, g *GameServer, uid string, name string, text string, now time.Time) {
+	t.Helper()
+	cmd, ok := ParseCommand('!', text)
+	if !ok {
+		t.Fatalf("%q did not parse", text)
+	}
+	cmd.UserID = uid
+	cmd.DisplayName = name
+	g.CommandsIn <- cmd
+	g.HandleCommands(now)
+}
+
+// Everything the game has said so far, merged into one string.
+func drainChat(g *GameServer) string {
+	var sb strings.Builder
+	for {
+		m, ok := g.MessagesOut.Pop(time.Now())
+		if !ok {
+			return sb.String()
+		}
+		sb.WriteString(m)
+		sb.WriteString("\n")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// Goblins can only rummage around when nothing is trying to kill them.
+func (g *GameServer) CanRummage(uid string) bool {
+	if g.Delve == nil || !slices.Contains(g.Standing(), uid) {
+		return false
+	}
+	if g.Delve.Combat != nil {
+		g.Say(PriorityNormal, "@"+g.Party.Name(uid)+" there is no time for that now!")
+		return false
+	}
+	return true
+}
+
+// Look around the room for anything lying on the floor.
+func (g *GameServer) Search(cmd Command) {
+	if !g.CanRummage(cmd.UserID) {
+		return
+	}
+	pc := g.Party.PlayerCharacters[cmd.UserID]
+	items, err := g.Inventory(g.Delve.RoomOwner())
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if len(items) == 0 {
+		g.Say(PriorityNormal, pc.Name+" searches the room and finds nothing.")
+		return
+	}
+	g.Say(PriorityNormal, pc.Name+" finds "+pc.ListItems(items)+". !grab [item]")
+}
+
+func (g *GameServer) Grab(cmd Command) {
+	if !g.CanRummage(cmd.UserID) {
+		return
+	}
+	if cmd.RawArgs == "" {
+		g.Search(cmd)
+		return
+	}
+	pc := g.Party.PlayerCharacters[cmd.UserID]
+	items, err := g.Inventory(g.Delve.RoomOwner())
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	item, _, suggestions := g.ParseItem(pc, items, cmd.RawArgs)
+	if item.ID == 0 {
+		if len(suggestions) == 0 {
+			g.Say(PriorityNormal, "@"+pc.Name+" there is no "+cmd.RawArgs+" here.")
+			return
+		}
+		g.DidYouMean(cmd, "!grab ", suggestions)
+		return
+	}
+
+	err = TransferItem(g.DB, g.Delve.RoomOwner(), CharacterOwner(pc.ID), item.ID)
+	if errors.Is(err, ErrCarryFull) {
+		g.Say(PriorityNormal, "@"+pc.Name+" cannot carry any more.")
+		return
+	} else if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	g.Say(PriorityNormal, pc.Name+" grabs the "+pc.ItemName(item)+".")
+}
+
+func (g *GameServer) Drop(cmd Command) {
+	if !g.CanRummage(cmd.UserID) {
+		return
+	}
+	pc := g.Party.PlayerCharacters[cmd.UserID]
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	item, _, suggestions := g.ParseItem(pc, items, cmd.RawArgs)
+	if item.ID == 0 {
+		g.UnknownItem(pc, items, "!drop ", suggestions)
+		return
+	}
+
+	err = TransferItem(g.DB, CharacterOwner(pc.ID), g.Delve.RoomOwner(), item.ID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	g.Say(PriorityNormal, pc.Name+" drops the "+pc.ItemName(item)+".")
+}
+
+// Hand an item to another goblin. In the dungeon only party members are
+// close enough.
+func (g *GameServer) Give(cmd Command) {
+	giver, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	inParty := g.Party.IsMember(cmd.UserID)
+	if inParty && g.Delve != nil && !g.CanRummage(cmd.UserID) {
+		return
+	}
+	items, err := g.Inventory(CharacterOwner(giver.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	item, target, suggestions := g.ParseItem(giver, items, cmd.RawArgs)
+	if item.ID == 0 {
+		g.UnknownItem(giver, items, "!give ", suggestions)
+		return
+	} else if target == "" {
+		g.Say(PriorityNormal, "@"+giver.Name+" give the "+giver.ItemName(item)+" to who?")
+		return
+	}
+	name, suggestions := g.ResolvePlayer(target)
+	if name == "" {
+		g.DidYouMean(cmd, "!give "+giver.ItemName(item)+" ", suggestions)
+		return
+	}
+	uid := g.KnownPlayers[name]
+	if uid == cmd.UserID {
+		return
+	}
+	if g.Party.IsMember(uid) != inParty || (inParty && g.Delve != nil && !slices.Contains(g.Targets(), uid)) {
+		g.Say(PriorityNormal, "@"+giver.Name+" "+name+" is not here.")
+		return
+	}
+	receiver, err := g.Character(uid)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	err = TransferItem(g.DB, CharacterOwner(giver.ID), CharacterOwner(receiver.ID), item.ID)
+	if errors.Is(err, ErrCarryFull) {
+		g.Say(PriorityNormal, "@"+giver.Name+" "+receiver.Name+" cannot carry any more.")
+		return
+	} else if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	g.Say(PriorityNormal, giver.Name+" gives "+receiver.Name+" the "+giver.ItemName(item)+".")
+}
+
+// Share out a monster's loot. Shinies go to the party pot and any item
+// drops go to whoever landed the killing blow, or the floor if they are full.
+func (g *GameServer) Loot(m Monster, uid string) {
+	found, drops, err := g.RollLoot(m)
+	if err != nil {
+		log.Println("game:", err)
+	}
+	if found > 0 {
+		g.Delve.Shinies += found
+		g.Say(PriorityNormal, fmt.Sprintf("The party finds %d shinies.", found))
+	}
+
+	pc := g.Party.PlayerCharacters[uid]
+	for _, item := range drops {
+		ok, err := GiveItem(g.DB, pc.ID, item.ID)
+		if err != nil {
+			log.Println("game:", err)
+		} else if ok {
+			g.Say(PriorityNormal, pc.Name+" grabs a "+pc.ItemName(item)+".")
+		} else if err = CreateItem(g.DB, g.Delve.RoomOwner(), item.ID); err != nil {
+			log.Println("game:", err)
+		} else {
+			g.Say(PriorityNormal, pc.Name+" has no room for the "+pc.ItemName(item)+" and leaves it on the floor.")
+		}
+	}
+}
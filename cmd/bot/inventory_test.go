@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestItemStacksAndSlots(t *testing.T) {
+	g, _ := newTestDelve(t)
+	owner := g.Delve.RoomOwner()
+
+	tx, err := g.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{2, 3, 3, 4} {
+		if err := AddItem(tx, owner, id, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveItem(tx, owner, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveItem(tx, owner, 2, 1); !errors.Is(err, ErrNoItem) {
+		t.Fatalf("removed an item that was gone: %v", err)
+	}
+	if err := AddItem(tx, owner, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := g.Inventory(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, 0, 6)
+	for _, item := range items {
+		got = append(got, item.ID, item.Count)
+	}
+	// Item 5 takes the slot item 2 left behind.
+	if want := []int{5, 2, 3, 2, 4, 1}; !slices.Equal(got, want) {
+		t.Fatalf("stacks %v, want %v", got, want)
+	}
+}
+
+func TestMigrateInventory(t *testing.T) {
+	db, err := OpenGameDB(newBaselineDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stacks := func() []int {
+		t.Helper()
+		rows, err := db.Query("SELECT owner_id, item_id, slot, count FROM ItemInstance ORDER BY owner_id, slot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		got := make([]int, 0, 8)
+		for rows.Next() {
+			var owner, item, slot, count int
+			if err := rows.Scan(&owner, &item, &slot, &count); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, owner, item, slot, count)
+		}
+		return got
+	}
+	// The two potions become one stack and the shank moves up a slot.
+	if got, want := stacks(), []int{1, 4, 1, 2, 1, 3, 2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("migrated %v, want %v", got, want)
+	}
+	if ok, err := TakeItem(db, 1, 4); !ok || err != nil {
+		t.Fatal("could not take a migrated potion:", err)
+	}
+	if ok, err := GiveItem(db, 1, 4); !ok || err != nil {
+		t.Fatal("could not give a potion back:", err)
+	}
+	if got, want := stacks(), []int{1, 4, 1, 2, 1, 3, 2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("after take and give %v, want %v", got, want)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO ItemInstance (item_id, owner_type, owner_id, slot) VALUES (4, 'character', 1, 9)
+		`); err == nil {
+		t.Fatal("a second potion stack was allowed")
+	}
+	if _, err := db.Exec("SELECT * FROM Inventory"); err == nil {
+		t.Fatal("old Inventory table is still there")
+	}
+	if _, err := db.Exec("SELECT agility, ranged FROM Item"); err != nil {
+		t.Fatal("item modifiers missing:", err)
+	}
+}
+
+func TestDropSearchGrab(t *testing.T) {
+	g, now := newTestDelve(t)
+	giveTestItem(t, g, "1", "Rusty Shank")
+
+	sendCommand(t, g, "2", "Bob", "!search", now)
+	if chat := drainChat(g); !strings.Contains(chat, "finds nothing") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	sendCommand(t, g, "1", "Alice", "!drop shank", now)
+	sendCommand(t, g, "2", "Bob", "!search", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Bob finds Rusty Shank.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	sendCommand(t, g, "2", "Bob", "!grab shank", now)
+
+	alice, _ := g.Inventory(CharacterOwner(g.Party.PlayerCharacters["1"].ID))
+	bob, _ := g.Inventory(CharacterOwner(g.Party.PlayerCharacters["2"].ID))
+	floor, _ := g.Inventory(g.Delve.RoomOwner())
+	if len(alice) != 0 || len(bob) != 1 || len(floor) != 0 {
+		t.Fatalf("shank in the wrong hands: %v %v %v", alice, bob, floor)
+	}
+}
+
+func TestCarryLimit(t *testing.T) {
+	g, now := newTestDelve(t)
+	for range CarryLimit {
+		giveTestItem(t, g, "2", "Rusty Shank")
+	}
+	if ok, _ := GiveItem(g.DB, g.Party.PlayerCharacters["2"].ID, 3); ok {
+		t.Fatal("carried more than the limit")
+	}
+
+	giveTestItem(t, g, "1", "Snotty Rags")
+	sendCommand(t, g, "1", "Alice", "!give rags bob", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Bob cannot carry any more") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if items, _ := g.Inventory(CharacterOwner(g.Party.PlayerCharacters["1"].ID)); len(items) != 1 {
+		t.Fatal("a failed give lost the item")
+	}
+
+	sendCommand(t, g, "1", "Alice", "!drop rags", now)
+	sendCommand(t, g, "2", "Bob", "!grab rags", now)
+	if floor, _ := g.Inventory(g.Delve.RoomOwner()); len(floor) != 1 {
+		t.Fatal("grabbed past the carry limit")
+	}
+
+	// Loot Bob has no room for is left where it fell.
+	_, err := g.DB.Exec(`
+	INSERT INTO LootTable (id, name, shinies) VALUES (99, 'test', '1d1');
+	INSERT INTO LootDrop (loot_table_id, item_id, chance) VALUES (99, 3, 1);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Loot(Monster{Name: "Rat", LootTableID: 99}, "2")
+	if chat := drainChat(g); !strings.Contains(chat, "leaves it on the floor") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if floor, _ := g.Inventory(g.Delve.RoomOwner()); len(floor) != 2 {
+		t.Fatal("loot past the carry limit was not left on the floor")
+	}
+}
+
+func TestGiveOnlyWithinReach(t *testing.T) {
+	g, now := newTestDelve(t)
+	giveTestItem(t, g, "1", "Rusty Shank")
+
+	// Carol is in town, far from the dungeon.
+	sendCommand(t, g, "3", "Carol", "!inventory", now)
+	sendCommand(t, g, "1", "Alice", "!give shank carol", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Carol is not here") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!give shank bob", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Alice gives Bob the Rusty Shank.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
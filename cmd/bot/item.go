@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Item struct {
+	ID          int
+	Name        string
+	Type        string
+	Value       int
+	Description string
+	Effects     []Effect // What using it does, if anything
+	Appearance  string   // How it looks until identified. Empty if obvious
+	Count       int      // How many are stacked together, if held
+
+	Attack     Dice // Weapons only. Zero if it is no weapon
+	Defense    int
+	AgilityMod int  // Added to the Agility of whoever equips it
+	Ranged     bool // Shot with !shoot rather than swung
+}
+
+func (g *GameServer) LoadItem(id int) (Item, error) {
+	var attack string
+	item := Item{ID: id}
+	err := g.Query[QueryItem].QueryRow(id).Scan(
+		&item.Name, &item.Type, &item.Value, &item.Description, &item.Appearance,
+		&attack, &item.Defense, &item.AgilityMod, &item.Ranged,
+	)
+	if err != nil {
+		return item, fmt.Errorf("load item %d: %w", id, err)
+	}
+	if attack != "" {
+		item.Attack, err = ParseDice(attack)
+		if err != nil {
+			return item, fmt.Errorf("load item %d: %w", id, err)
+		}
+	}
+	item.Effects, err = g.LoadEffects(QueryItemEffects, id)
+	if err != nil {
+		return item, fmt.Errorf("load item %d: %w", id, err)
+	}
+	return item, nil
+}
+
+// Stacks of items an owner holds, in slot order.
+func (g *GameServer) Inventory(owner Owner) ([]Item, error) {
+	rows, err := g.Query[QueryInventory].Query(owner.Type, owner.ID)
+	if err != nil {
+		return nil, fmt.Errorf("inventory %v: %w", owner, err)
+	}
+	type stack struct{ id, count int }
+	stacks := make([]stack, 0, CarryLimit)
+	for rows.Next() {
+		var st stack
+		if err := rows.Scan(&st.id, &st.count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("inventory %v: %w", owner, err)
+		}
+		stacks = append(stacks, st)
+	}
+	rows.Close()
+
+	items := make([]Item, 0, len(stacks))
+	for _, st := range stacks {
+		item, err := g.LoadItem(st.id)
+		if err != nil {
+			return nil, err
+		}
+		item.Count = st.count
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Item IDs a character has identified.
+func (g *GameServer) KnownItems(characterID int) (map[int]bool, error) {
+	rows, err := g.Query[QueryKnownItems].Query(characterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		known[id] = true
+	}
+	return known, rows.Err()
+}
+
+// What the character calls an item.
+func (c Character) ItemName(item Item) string {
+	if item.Appearance == "" || c.Known[item.ID] {
+		return item.Name
+	}
+	return item.Appearance
+}
+
+// What the character calls each item, each once.
+func (c Character) ItemNames(items []Item) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if name := c.ItemName(item); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Split "item [target]" into a carried item and the target's name. Items
+// go by the names the character knows them by.
+func (g *GameServer) ParseItem(c Character, items []Item, raw string) (Item, string, []string) {
+	match, target, suggestions := SplitTarget(raw, c.ItemNames(items))
+	for _, item := range items {
+		if match != "" && c.ItemName(item) == match {
+			return item, target, nil
+		}
+	}
+	return Item{}, "", suggestions
+}
+
+// Learn what an item is. Returns true if it was news to them.
+func (g *GameServer) Identify(uid string, item Item) bool {
+	pc := g.Party.PlayerCharacters[uid]
+	if item.Appearance == "" || pc.Known[item.ID] {
+		return false
+	}
+	if err := LearnItem(g.DB, pc.ID, item.ID); err != nil {
+		log.Println("game:", err)
+		return false
+	}
+	if pc.Known == nil {
+		pc.Known = make(map[int]bool)
+	}
+	pc.Known[item.ID] = true
+	g.Party.PlayerCharacters[uid] = pc
+	return true
+}
+
+// Ready an item so that using it later cannot be fumbled.
+func (g *GameServer) Ready(uid string, raw string) {
+	pc := g.Party.PlayerCharacters[uid]
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if len(items) == 0 {
+		g.Say(PriorityNormal, pc.Name+" has nothing to ready.")
+		return
+	}
+	if raw == "" {
+		g.Say(PriorityNormal, "@"+pc.Name+" ready what? "+strings.Join(pc.ItemNames(items), ", "))
+		return
+	}
+
+	item, _, suggestions := g.ParseItem(pc, items, raw)
+	if item.ID == 0 {
+		g.UnknownItem(pc, items, "!ready ", suggestions)
+		return
+	} else if len(item.Effects) == 0 {
+		g.Say(PriorityNormal, pc.Name+" cannot use the "+pc.ItemName(item)+".")
+		return
+	}
+	pc.Readied = item.ID
+	g.Party.PlayerCharacters[uid] = pc
+	g.Say(PriorityNormal, pc.Name+" readies the "+pc.ItemName(item)+".")
+}
+
+// Use the readied item, or name one. Using up an item that was not readied
+// needs an Agility check or the goblin fumbles for it.
+func (g *GameServer) Use(uid string, raw string, now time.Time) {
+	pc := g.Party.PlayerCharacters[uid]
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if len(items) == 0 {
+		g.Say(PriorityNormal, pc.Name+" has nothing to use.")
+		return
+	}
+
+	item, target, suggestions := g.ParseItem(pc, items, raw)
+	if item.ID == 0 {
+		i := slices.IndexFunc(items, func(item Item) bool { return item.ID == pc.Readied })
+		if pc.Readied == 0 || i < 0 {
+			if raw == "" {
+				g.Say(PriorityNormal, pc.Name+" has nothing readied.")
+			} else {
+				g.UnknownItem(pc, items, "!use ", suggestions)
+			}
+			return
+		}
+		item, target = items[i], raw
+	}
+
+	name := pc.ItemName(item)
+	if len(item.Effects) == 0 {
+		g.Say(PriorityNormal, pc.Name+" cannot use the "+name+".")
+		return
+	}
+	// Only those who know what it does know to save it for a fight.
+	if g.Delve.Combat == nil && item.Effects[0].Target == TargetMonster && name == item.Name {
+		g.Say(PriorityNormal, "There is nothing for "+pc.Name+" to use the "+name+" on.")
+		return
+	}
+	if item.ID != pc.Readied && !g.StatCheck(pc.Agility) {
+		g.Say(PriorityNormal, pc.Name+" fumbles for the "+name+".")
+		return
+	}
+
+	ok, err := TakeItem(g.DB, pc.ID, item.ID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	} else if !ok {
+		return
+	}
+	if item.ID == pc.Readied {
+		pc.Readied = 0
+		g.Party.PlayerCharacters[uid] = pc
+	}
+
+	m := pc.Name + " uses the " + name + "!"
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+
+	// Everyone sees what happens when it affects the whole party.
+	witnesses := []string{uid}
+	if slices.ContainsFunc(item.Effects, func(e Effect) bool { return e.Target == TargetParty }) {
+		witnesses = g.Party.Members
+	}
+	learned := false
+	for _, member := range witnesses {
+		learned = g.Identify(member, item) || learned
+	}
+	if learned {
+		g.Say(PriorityNormal, "It was a "+item.Name+"!")
+	}
+
+	g.ApplyEffects(item.Name, uid, target, item.Effects, now)
+}
+
+// List what a goblin carries, by the names the viewer knows.
+func (g *GameServer) ShowInventory(viewer Character, c Character) {
+	items, err := g.Inventory(CharacterOwner(c.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if len(items) == 0 {
+		g.Say(PriorityNormal, c.Name+" carries nothing.")
+		return
+	}
+	g.Say(PriorityNormal, c.Name+" carries "+viewer.ListItems(items)+".")
+}
+
+// Items by the names the character knows, with stacks counted.
+func (c Character) ListItems(items []Item) string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = c.ItemName(item)
+		if item.Count > 1 {
+			names[i] += fmt.Sprintf(" x%d", item.Count)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *GameServer) UnknownItem(pc Character, items []Item, prefix string, suggestions []string) {
+	if len(suggestions) == 0 {
+		g.Say(PriorityNormal, "@"+pc.Name+" carries "+strings.Join(pc.ItemNames(items), ", ")+".")
+		return
+	}
+	g.DidYouMean(Command{DisplayName: pc.Name}, prefix, suggestions)
+}
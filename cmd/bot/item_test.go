@@ -0,0 +1,212 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Put the named item in a member's pack.
+func giveTestItem(t *testing.T, g *GameServer, uid string, name string) int {
+	t.Helper()
+	var id int
+	err := g.DB.QueryRow("SELECT id FROM Item WHERE name = ?", name).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := GiveItem(g.DB, g.Party.PlayerCharacters[uid].ID, id)
+	if err != nil || !ok {
+		t.Fatalf("could not give %s: %v", name, err)
+	}
+	return id
+}
+
+func TestItemEffectsLoaded(t *testing.T) {
+	g, _ := newTestDelve(t)
+	id := giveTestItem(t, g, "1", "Potion of Grom's Blood")
+
+	item, err := g.LoadItem(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != "consumable" || len(item.Effects) != 1 || item.Effects[0].Kind != EffectHeal {
+		t.Fatalf("potion loaded wrong: %+v", item)
+	}
+}
+
+func TestUseReadiedPotion(t *testing.T) {
+	g, now := newTestDelve(t)
+	id := giveTestItem(t, g, "1", "Potion of Grom's Blood")
+	alice := g.Party.PlayerCharacters["1"]
+	alice.HP = 1
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "1", "Alice", "!ready potion", now)
+	sendCommand(t, g, "1", "Alice", "!use", now)
+	if alice = g.Party.PlayerCharacters["1"]; alice.HP < 3 || alice.Readied != 0 {
+		t.Fatalf("potion should heal at least 2: %+v", alice)
+	}
+	if items, _ := g.Inventory(CharacterOwner(alice.ID)); len(items) != 0 {
+		t.Fatalf("potion was not used up: %v", items)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "potion! | It was a Potion of Grom's Blood!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if !alice.Known[id] {
+		t.Fatal("Alice did not learn what the potion was")
+	}
+	if g.Party.PlayerCharacters["2"].Known[id] {
+		t.Fatal("Bob learned about a potion they never saw")
+	}
+}
+
+func TestUseUnreadiedCanFumble(t *testing.T) {
+	g, now := newTestDelve(t)
+	giveTestItem(t, g, "1", "Potion of Grom's Blood")
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Agility = 0
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "1", "Alice", "!use potion", now)
+	if items, _ := g.Inventory(CharacterOwner(alice.ID)); len(items) != 1 {
+		t.Fatal("a fumbled potion was used up")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "fumbles") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestThrowBeesInCombat(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g, now := newTestCombat(t, m)
+	giveTestItem(t, g, "1", "Jar of Angry Bees")
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Agility = 20
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "1", "Alice", "!use jar", now)
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+	if hp := g.Delve.Combat.Monster.HP; hp > 98 {
+		t.Fatalf("the bees did too little, monster at %d\n%s", hp, drainChat(g))
+	}
+}
+
+func TestAppearancesPerWorld(t *testing.T) {
+	items := []DatabaseItem{
+		{Name: "Red", Form: "potion"},
+		{Name: "Blue", Form: "potion"},
+		{Name: "Sword"},
+	}
+	pools := map[string][]string{"potion": {"murky", "fizzy", "lumpy", "smoky"}}
+
+	first, err := ShuffleAppearances(1, items, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ShuffleAppearances(1, items, pools)
+	if first["Red"] != again["Red"] || first["Blue"] != again["Blue"] {
+		t.Fatal("the same world shuffled differently")
+	}
+	if first["Red"] == first["Blue"] || first["Sword"] != "" {
+		t.Fatalf("bad appearances %v", first)
+	}
+
+	differs := false
+	for seed := range uint64(20) {
+		other, _ := ShuffleAppearances(seed+2, items, pools)
+		differs = differs || other["Red"] != first["Red"]
+	}
+	if !differs {
+		t.Fatal("every world looks the same")
+	}
+
+	items = append(items, DatabaseItem{Name: "Green", Form: "scroll"})
+	if _, err := ShuffleAppearances(1, items, pools); err == nil {
+		t.Fatal("accepted a form without appearances")
+	}
+}
+
+func TestInventoryShowsWhatViewerKnows(t *testing.T) {
+	g, now := newTestDelve(t)
+	id := giveTestItem(t, g, "2", "Potion of Grom's Blood")
+	item, _ := g.LoadItem(id)
+	if item.Appearance == "" {
+		t.Fatal("potion has no appearance")
+	}
+
+	sendCommand(t, g, "1", "Alice", "!inspect bob", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Bob carries "+item.Appearance+".") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	g.Identify("1", item)
+	alice, err := g.LoadCharacter("1")
+	if err != nil || !alice.Known[id] {
+		t.Fatal("knowledge was not saved")
+	}
+	sendCommand(t, g, "1", "Alice", "!inspect bob", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Bob carries Potion of Grom's Blood.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	sendCommand(t, g, "2", "Bob", "!inventory", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Bob carries "+item.Appearance+".") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestPartyWitnessesScroll(t *testing.T) {
+	g, now := newTestDelve(t)
+	id := giveTestItem(t, g, "1", "Scroll of Scurrying")
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Agility = 20
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "1", "Alice", "!use scroll", now)
+	for _, uid := range g.Party.Members {
+		if !g.Party.PlayerCharacters[uid].Known[id] {
+			t.Fatalf("%s did not learn the scroll", g.Party.Name(uid))
+		}
+	}
+}
+
+func TestTeleportToStairs(t *testing.T) {
+	g, now := newTestCombat(t, testMonster())
+	for i := range g.Delve.Chunk.Rooms {
+		g.Delve.Chunk.Rooms[i].Stairs = StairNone
+	}
+	stairs := Position{X: 0, Y: 0}
+	g.Delve.Chunk.Rooms[0].Stairs = StairDown
+
+	g.ApplyEffect("Scroll of Scurrying", "1", "", Effect{Kind: EffectTeleport, Target: TargetParty}, now)
+	if g.Delve.RoomPos != stairs {
+		t.Fatalf("party at %v, want %v", g.Delve.RoomPos, stairs)
+	}
+	if g.Delve.Combat != nil || g.Delve.Vote == nil {
+		t.Fatal("teleporting should leave the fight behind")
+	}
+}
+
+func TestTrapSprings(t *testing.T) {
+	g, now := newTestDelve(t)
+	for _, uid := range g.Party.Members {
+		pc := g.Party.PlayerCharacters[uid]
+		pc.Agility = -10
+		g.Party.PlayerCharacters[uid] = pc
+	}
+	dir := g.Delve.Exits()[0]
+	g.Delve.Chunk.Rooms[0].Trap = false
+	next := g.Delve.RoomPos.Step(dir)
+	trapped := &g.Delve.Chunk.Rooms[next.X+CHUNKSIZEROOT*next.Y]
+	trapped.Trap = true
+
+	sendCommand(t, g, "1", "Alice", "!"+DirectionNames[dir], now)
+	sendCommand(t, g, "2", "Bob", "!"+DirectionNames[dir], now)
+	g.Update(now.Add(time.Second))
+	if trapped.Trap {
+		t.Fatal("trap did not spring")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "springs a") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
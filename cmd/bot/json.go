@@ -16,6 +16,34 @@ type JSONErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// https://dev.twitch.tv/docs/api/reference/#send-chat-message
+type JSONChatMessageResponse struct {
+	Data []struct {
+		MessageID  string `json:"message_id"`
+		IsSent     bool   `json:"is_sent"`
+		DropReason struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"drop_reason"`
+	} `json:"data"`
+}
+
+type JSONTokenValidation struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	Scopes    []string `json:"scopes"`
+	UserID    string   `json:"user_id"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+type JSONDeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+}
+
 type WSResponse struct {
 	Metadata map[string]string `json:"metadata"`
 	Payload  map[string]string `json:"payload"`
@@ -97,15 +125,29 @@ type WSMessageType struct {
 	} `json:"metadata"`
 }
 
-type WSSessionID struct {
+// Payload of session_welcome and session_reconnect messages.
+type WSSession struct {
 	Payload struct {
 		Session struct {
-			ID     string `json:"id"`
-			Status string `json:"status"`
+			ID                      string `json:"id"`
+			Status                  string `json:"status"`
+			KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+			ReconnectURL            string `json:"reconnect_url"`
 		} `json:"session"`
 	} `json:"payload"`
 }
 
+type WSRevocation struct {
+	Payload struct {
+		Subscription struct {
+			ID      string `json:"id"`
+			Status  string `json:"status"`
+			Type    string `json:"type"`
+			Version string `json:"version"`
+		} `json:"subscription"`
+	} `json:"payload"`
+}
+
 func PrettyPrint(v any) {
 	b, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
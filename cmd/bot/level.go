@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// Stats in the order they are rolled and grown.
+var StatNames = []string{"might", "agility", "will"}
+
+// The stars a goblin was born under. The favored stat starts higher and grows
+// more often.
+type BirthSign struct {
+	Name   string
+	Favors string // One of StatNames
+}
+
+var BirthSigns = []BirthSign{
+	{"the Boar", "might"},
+	{"the Rat", "agility"},
+	{"the Owl", "will"},
+}
+
+func FindBirthSign(name string) BirthSign {
+	for _, s := range BirthSigns {
+		if s.Name == name {
+			return s
+		}
+	}
+	return BirthSign{}
+}
+
+var (
+	StatDice = MustParseDice("2d4+4")
+	HPDice   = MustParseDice("1d4+2")
+
+	// HP gained with each level.
+	LevelHPDice = MustParseDice("1d4")
+)
+
+// Stat points handed out with each level.
+const StatPointsPerLevel = 2
+
+// No stat grows past what a check can roll.
+const StatMax = 20
+
+// Experience needed to reach each level, starting from level 1.
+var LevelXP = []int{0, 20, 50, 100, 180, 300, 500, 800, 1200, 1800}
+
+// The level a goblin with xp experience has reached.
+func LevelFor(xp int) int {
+	level := 1
+	for level < len(LevelXP) && xp >= LevelXP[level] {
+		level++
+	}
+	return level
+}
+
+// Roll a new goblin's birth sign, stats in StatNames order and HP.
+func RollCharacter(r *rand.Rand) (BirthSign, [3]int, int) {
+	sign := BirthSigns[r.IntN(len(BirthSigns))]
+	var stats [3]int
+	for i, name := range StatNames {
+		stats[i] = StatDice.Roll(r)
+		if name == sign.Favors {
+			stats[i]++
+		}
+	}
+	return sign, stats, HPDice.Roll(r)
+}
+
+// Hand out one level's stat points. Low stats are likelier to grow, and the
+// favored stat twice as likely. Returns the gain in each stat.
+func GrowStats(r *rand.Rand, sign BirthSign, stats [3]int) [3]int {
+	var gains [3]int
+	for range StatPointsPerLevel {
+		var weights [3]int
+		total := 0
+		for i, name := range StatNames {
+			weights[i] = max(0, StatMax-stats[i]-gains[i])
+			if name == sign.Favors {
+				weights[i] *= 2
+			}
+			total += weights[i]
+		}
+		if total == 0 {
+			break
+		}
+		roll := r.IntN(total)
+		for i, w := range weights {
+			if roll < w {
+				gains[i]++
+				break
+			}
+			roll -= w
+		}
+	}
+	return gains
+}
+
+// Stats as saved, without what gear adds.
+func (c Character) BaseStats() [3]int {
+	gear := c.Weapon.AgilityMod + c.Armor.AgilityMod
+	return [3]int{c.MightMax, c.AgilityMax - gear, c.WillMax}
+}
+
+// A line in the delve's XP ledger.
+type XPEntry struct {
+	Reason string
+	XP     int
+}
+
+// Record experience earned on the delve, paid out on returning home.
+func (d *Delve) EarnXP(reason string, xp int) {
+	if xp <= 0 {
+		return
+	}
+	i := slices.IndexFunc(d.Ledger, func(e XPEntry) bool { return e.Reason == reason })
+	if i < 0 {
+		d.Ledger = append(d.Ledger, XPEntry{Reason: reason, XP: xp})
+		return
+	}
+	d.Ledger[i].XP += xp
+}
+
+// Experience earned on top of treasure.
+func (d *Delve) BonusXP() int {
+	total := 0
+	for _, e := range d.Ledger {
+		total += e.XP
+	}
+	return total
+}
+
+// Where the party's experience came from, treasure first.
+func (d *Delve) LedgerSummary() string {
+	parts := make([]string, 0, len(d.Ledger)+1)
+	if d.Shinies > 0 {
+		parts = append(parts, fmt.Sprintf("treasure %d", d.Shinies))
+	}
+	for _, e := range d.Ledger {
+		parts = append(parts, fmt.Sprintf("%s %d", e.Reason, e.XP))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The party makes it back to Goblin Town and shares out the treasure. Every
+// shiny is worth one experience point.
+func (g *GameServer) ReturnHome() {
+	d := g.Delve
+	n := len(g.Party.Members)
+	if n > 0 && d.Shinies+d.BonusXP() > 0 {
+		shinies := d.Shinies / n
+		xp := (d.Shinies + d.BonusXP()) / n
+		g.Say(PriorityNormal, fmt.Sprintf("Each goblin takes home %d shinies and %d XP (%s).",
+			shinies, xp, d.LedgerSummary()))
+		for _, uid := range g.Party.Members {
+			g.Award(uid, shinies, xp)
+		}
+	}
+	g.EndDelve()
+}
+
+// Give a goblin their share and level them up if they crossed a threshold.
+func (g *GameServer) Award(uid string, shinies int, xp int) {
+	pc := g.Party.PlayerCharacters[uid]
+	err := AwardCharacter(g.DB, pc.ID, shinies, xp)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	level := LevelFor(pc.Experience + xp)
+	if level <= pc.Level {
+		return
+	}
+	sign := FindBirthSign(pc.Sign)
+	stats := pc.BaseStats()
+	var gains [3]int
+	hp := 0
+	for range level - pc.Level {
+		grown := GrowStats(g.Rand, sign, stats)
+		for i := range gains {
+			gains[i] += grown[i]
+			stats[i] += grown[i]
+		}
+		hp += LevelHPDice.Roll(g.Rand)
+	}
+	err = LevelCharacter(g.DB, pc.ID, level, gains, hp)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	growth := []string{fmt.Sprintf("HP +%d", hp)}
+	for i, name := range StatNames {
+		if gains[i] > 0 {
+			growth = append(growth, fmt.Sprintf("%s +%d", name, gains[i]))
+		}
+	}
+	m := fmt.Sprintf("%s reaches level %d! %s.", pc.Name, level, strings.Join(growth, ", "))
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestLevelFor(t *testing.T) {
+	cases := []struct{ xp, level int }{
+		{0, 1}, {19, 1}, {20, 2}, {49, 2}, {50, 3}, {1_000_000, len(LevelXP)},
+	}
+	for _, c := range cases {
+		if got := LevelFor(c.xp); got != c.level {
+			t.Errorf("LevelFor(%d) = %d, want %d", c.xp, got, c.level)
+		}
+	}
+}
+
+func TestRollCharacter(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	signs := make(map[string]bool)
+	for range 200 {
+		sign, stats, hp := RollCharacter(r)
+		signs[sign.Name] = true
+		for i, name := range StatNames {
+			lo, hi := StatDice.Min(), StatDice.Max()
+			if name == sign.Favors {
+				lo, hi = lo+1, hi+1
+			}
+			if stats[i] < lo || stats[i] > hi {
+				t.Fatalf("%s %d out of range for %s", name, stats[i], sign.Name)
+			}
+		}
+		if hp < HPDice.Min() || hp > HPDice.Max() {
+			t.Fatalf("rolled %d HP", hp)
+		}
+	}
+	if len(signs) != len(BirthSigns) {
+		t.Fatalf("only rolled signs %v", signs)
+	}
+}
+
+func TestGrowStatsFavorsLowAndSign(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	owl := FindBirthSign("the Owl")
+	var total [3]int
+	for range 1000 {
+		gains := GrowStats(r, owl, [3]int{8, 14, 8})
+		for i := range total {
+			total[i] += gains[i]
+		}
+	}
+	might, agility, will := total[0], total[1], total[2]
+	if agility >= might || might >= will {
+		t.Fatalf("growth might %d agility %d will %d", might, agility, will)
+	}
+
+	maxed := GrowStats(r, owl, [3]int{StatMax, StatMax, StatMax})
+	if maxed != [3]int{} {
+		t.Fatalf("stats grew past the cap: %v", maxed)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	d := &Delve{Shinies: 7}
+	d.EarnXP("slaying", 5)
+	d.EarnXP("sneaking", 2)
+	d.EarnXP("slaying", 3)
+	d.EarnXP("stealing", 0)
+	if d.BonusXP() != 10 || len(d.Ledger) != 2 {
+		t.Fatalf("ledger %v", d.Ledger)
+	}
+	if got := d.LedgerSummary(); got != "treasure 7, slaying 8, sneaking 2" {
+		t.Fatalf("summary %q", got)
+	}
+}
+
+func TestLevelUpOnReturnHome(t *testing.T) {
+	g, now := newTestDelve(t)
+	before := g.Party.PlayerCharacters["1"]
+	g.Delve.Shinies = 2 * LevelXP[2]
+
+	sendCommand(t, g, "1", "Alice", "!home", now)
+	sendCommand(t, g, "2", "Bob", "!home", now)
+	if g.Phase != PhaseTown {
+		t.Fatal("party did not return home")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "Alice reaches level 3!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	after, err := g.LoadCharacter("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Level != 3 || after.Experience != LevelXP[2] || after.Sign != before.Sign {
+		t.Fatalf("level %d with %d XP", after.Level, after.Experience)
+	}
+	grown := after.Might + after.Agility + after.Will - before.Might - before.Agility - before.Will
+	if grown != 2*StatPointsPerLevel || after.HPMax < before.HPMax+2 {
+		t.Fatalf("grew %d stat points and %d HP", grown, after.HPMax-before.HPMax)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// What the game is doing. Commands are only accepted in the phases they
+// make sense in.
+type Phase int
+
+const (
+	PhaseTown  Phase = iota // No party. Goblins hang out in Goblin Town
+	PhaseLobby              // A party is forming
+	PhaseDelve              // The party is locked in the dungeon
+)
+
+// How long a forming party waits before the delve starts on its own.
+const LobbyWait = 10 * time.Second
+
+// One trip into the dungeon by a locked party.
+type Delve struct {
+	*Dungeon
+
+	Started time.Time
+
+	Shinies int       // Treasure collected, shared out on returning home
+	Ledger  []XPEntry // Experience earned on top of treasure
+	Rests   int       // Rests taken so far
+	Light   int       // Rooms left before the party's light goes out
+
+	Vote      *Vote      // Nil unless the party is deciding where to go
+	Combat    *Combat    // Nil unless the party is fighting
+	Encounter *Encounter // Nil unless the party found a monster unaware
+	Rest      *Rest      // Nil unless the party is resting
+}
+
+func NewDelve(seed uint64, now time.Time) *Delve {
+	return &Delve{
+		Dungeon: NewDungeon(seed),
+		Started: now,
+	}
+}
+
+func (p *Party) IsMember(uid string) bool {
+	return slices.Contains(p.Members, uid)
+}
+
+func (p *Party) IsFull() bool {
+	return len(p.Members) >= p.PlayersMax
+}
+
+// Add a member. The first member leads.
+func (p *Party) Add(c Character) {
+	if len(p.Members) == 0 {
+		p.Leader = c.UserID
+	}
+	p.Members = append(p.Members, c.UserID)
+	p.PlayerCharacters[c.UserID] = c
+}
+
+// Remove a member. Leadership passes to the longest standing member left.
+func (p *Party) Remove(uid string) {
+	p.Members = slices.DeleteFunc(p.Members, func(m string) bool { return m == uid })
+	delete(p.PlayerCharacters, uid)
+	if p.Leader == uid {
+		p.Leader = ""
+		if len(p.Members) > 0 {
+			p.Leader = p.Members[0]
+		}
+	}
+}
+
+func (p *Party) Disband() {
+	p.Leader = ""
+	p.Members = p.Members[:0]
+	clear(p.PlayerCharacters)
+}
+
+// Display name of a party member.
+func (p *Party) Name(uid string) string {
+	return p.PlayerCharacters[uid].Name
+}
+
+func (g *GameServer) Join(cmd Command, now time.Time) {
+	switch g.Phase {
+	case PhaseDelve:
+		g.Say(PriorityNormal, "@"+cmd.Name()+" the party is already in the dungeon. Wait for them to return!")
+		return
+	case PhaseLobby:
+		if g.Party.IsMember(cmd.UserID) {
+			return
+		}
+		if g.Party.IsFull() {
+			g.Say(PriorityNormal, "@"+cmd.Name()+" the party is full.")
+			return
+		}
+	}
+
+	c, err := g.LoadCharacter(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+
+	g.Party.Add(c)
+	m := c.Name + " joined the party!"
+	if g.Phase == PhaseTown {
+		g.Phase = PhaseLobby
+		g.LobbyDeadline = now.Add(g.LobbyWait)
+		m += fmt.Sprintf(" !join within %d seconds. %s leads and may !begin.",
+			int(g.LobbyWait.Seconds()), c.Name)
+	}
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+
+	if g.Party.IsFull() {
+		g.Begin(now)
+	}
+}
+
+func (g *GameServer) Leave(cmd Command) {
+	if g.Phase == PhaseDelve && g.Party.IsMember(cmd.UserID) {
+		g.Say(PriorityNormal, "@"+cmd.Name()+" there is no leaving now. The party is locked until it returns home.")
+		return
+	}
+	if g.Phase != PhaseLobby || !g.Party.IsMember(cmd.UserID) {
+		return
+	}
+
+	name := g.Party.Name(cmd.UserID)
+	wasLeader := g.Party.Leader == cmd.UserID
+	g.Party.Remove(cmd.UserID)
+
+	m := name + " left the party."
+	if len(g.Party.Members) == 0 {
+		g.Phase = PhaseTown
+		m += " The party has disbanded."
+	} else if wasLeader {
+		m += " " + g.Party.Name(g.Party.Leader) + " now leads."
+	}
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+}
+
+// Only the leader may start the delve early.
+func (g *GameServer) BeginCommand(cmd Command, now time.Time) {
+	if g.Phase != PhaseLobby || g.Party.Leader != cmd.UserID {
+		return
+	}
+	g.Begin(now)
+}
+
+// Lock the party and enter the dungeon.
+func (g *GameServer) Begin(now time.Time) {
+	if g.Phase != PhaseLobby {
+		return
+	}
+	g.Phase = PhaseDelve
+	g.Delve = NewDelve(g.Rand.Uint64(), now)
+	if err := ClearRooms(g.DB); err != nil {
+		log.Println("game:", err)
+	}
+
+	m := fmt.Sprintf("The party of %d descends into The Dungeons of Chaos!", len(g.Party.Members))
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+
+	g.EnterRoom(now)
+}
+
+// A member leaves the delve, having returned home or died. The party is
+// unlocked once no one is left in the dungeon.
+func (g *GameServer) LeaveDelve(uid string) {
+	if g.Phase != PhaseDelve {
+		return
+	}
+	g.Party.Remove(uid)
+	if len(g.Party.Members) == 0 {
+		g.EndDelve()
+	}
+}
+
+// Whatever was left behind in the dungeon is lost.
+func (g *GameServer) EndDelve() {
+	if err := ClearRooms(g.DB); err != nil {
+		log.Println("game:", err)
+	}
+	g.Party.Disband()
+	g.Delve = nil
+	g.Phase = PhaseTown
+	log.Println("game: The delve is over.")
+}
+
+// Advance timers that do not wait for commands.
+func (g *GameServer) Update(now time.Time) {
+	if g.Phase == PhaseLobby && !now.Before(g.LobbyDeadline) {
+		g.Begin(now)
+	}
+	if g.Delve != nil && g.Delve.Vote != nil && !now.Before(g.Delve.Vote.Deadline) {
+		g.CloseVote(now)
+	}
+	if g.Delve != nil && g.Delve.Combat != nil && !now.Before(g.Delve.Combat.Deadline) {
+		g.ResolveRound(now)
+	}
+	if g.Delve != nil && g.Delve.Encounter != nil && !now.Before(g.Delve.Encounter.Deadline) {
+		g.CloseEncounter(now)
+	}
+	if g.Delve != nil && g.Delve.Rest != nil {
+		g.UpdateRest(now)
+	}
+	g.UpdateLottery(now)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLobbyLeaderAndLeave(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+	now := time.Now()
+
+	sendCommand(t, g, "1", "Alice", "!join", now)
+	sendCommand(t, g, "2", "Bob", "!join", now)
+	sendCommand(t, g, "2", "Bob", "!join", now)
+	if g.Phase != PhaseLobby || g.Party.Leader != "1" || len(g.Party.Members) != 2 {
+		t.Fatalf("phase %d leader %q members %v", g.Phase, g.Party.Leader, g.Party.Members)
+	}
+
+	sendCommand(t, g, "2", "Bob", "!begin", now)
+	if g.Phase != PhaseLobby {
+		t.Fatal("only the leader may begin")
+	}
+
+	sendCommand(t, g, "1", "Alice", "!leave", now)
+	if g.Party.Leader != "2" || g.Party.IsMember("1") {
+		t.Fatalf("leadership did not pass on: leader %q", g.Party.Leader)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "Alice left the party. Bob now leads.") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	sendCommand(t, g, "2", "Bob", "!leave", now)
+	if g.Phase != PhaseTown || len(g.Party.Members) != 0 {
+		t.Fatal("empty party should disband")
+	}
+}
+
+func TestLobbyStartsAndLocks(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+	now := time.Now()
+
+	sendCommand(t, g, "1", "Alice", "!join", now)
+	g.Update(now.Add(g.LobbyWait - time.Second))
+	if g.Phase != PhaseLobby {
+		t.Fatal("delve started early")
+	}
+	g.Update(now.Add(g.LobbyWait))
+	if g.Phase != PhaseDelve || g.Delve == nil {
+		t.Fatal("delve did not start after the lobby wait")
+	}
+
+	sendCommand(t, g, "2", "Bob", "!join", now)
+	sendCommand(t, g, "1", "Alice", "!leave", now)
+	if g.Party.IsMember("2") || !g.Party.IsMember("1") {
+		t.Fatal("party should be locked during the delve")
+	}
+	chat := drainChat(g)
+	if !strings.Contains(chat, "already in the dungeon") || !strings.Contains(chat, "no leaving now") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	g.LeaveDelve("1")
+	if g.Phase != PhaseTown || g.Delve != nil {
+		t.Fatal("party should unlock once everyone is home")
+	}
+}
+
+func TestLobbyFullStarts(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+	g.Party.PlayersMax = 2
+	now := time.Now()
+
+	sendCommand(t, g, "1", "Alice", "!join", now)
+	sendCommand(t, g, "2", "Bob", "!join", now)
+	if g.Phase != PhaseDelve {
+		t.Fatal("a full party should start the delve")
+	}
+	c := g.Party.PlayerCharacters["2"]
+	if c.Name != "Bob" || c.HPMax == 0 || c.ID == 0 {
+		t.Fatalf("character not loaded: %+v", c)
+	}
+}
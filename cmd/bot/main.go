@@ -1,5 +1,10 @@
 package main
 
+import (
+	"flag"
+	"log"
+)
+
 const (
 	Host   = "127.0.0.1"
 	Port   = ":8000"
@@ -9,7 +14,11 @@ const (
 	CertFile = "certs/localhost.crt"
 	KeyFile  = "certs/localhost.key"
 
-	EventSubAddr = "eventsub.wss.twitch.tv"
+	TokenFile = "db/user_token.json"
+
+	TwitchAuthURL     = "https://id.twitch.tv"
+	TwitchAPIURL      = "https://api.twitch.tv"
+	TwitchEventSubURL = "wss://eventsub.wss.twitch.tv/ws"
 
 	ExitSuccess   int = 0
 	ExitError     int = 1
@@ -17,9 +26,28 @@ const (
 )
 
 func main() {
+	authFlag := flag.String("auth", "code", "authorization flow: code (browser on this machine) or device (headless)")
+	transportFlag := flag.String("transport", "twitch", "where the game is played: twitch or terminal")
+	houseEdgeFlag := flag.Float64("house-edge", DefaultHouseEdge, "fraction of every bet the house keeps on average, from 0 to 1")
+	flag.Parse()
+
+	authFlow, err := ParseAuthFlow(*authFlag)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *houseEdgeFlag < 0 || *houseEdgeFlag >= 1 {
+		log.Fatalln("house edge must be from 0 up to 1")
+	}
+
 	gameServer := NewGameServer()
-	bot := NewChatBot(gameServer)
+	gameServer.HouseEdge = *houseEdgeFlag
+	transport, err := NewTransport(*transportFlag, authFlow)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	transport.Attach(gameServer)
 	//bot.RequestUserInfo("crashtestgoblin")
 	go gameServer.Run()
-	bot.Run()
+	transport.Run()
 }
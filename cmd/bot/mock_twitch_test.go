@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	mockClientID    = "mock-client"
+	mockBotID       = "9000"
+	mockBroadcaster = "1000"
+	mockAccessToken = "mock-access"
+)
+
+// An in-process stand-in for the parts of Twitch the bot talks to: the OAuth
+// token endpoints, the Helix chat and subscription endpoints, and an EventSub
+// websocket that tests can push notifications through.
+type MockTwitch struct {
+	Server *httptest.Server
+
+	// Seconds reported in session welcomes, and how often keepalives are sent.
+	KeepaliveSeconds int
+	KeepaliveEvery   time.Duration
+
+	mu            sync.Mutex
+	writeMu       sync.Mutex
+	conn          *websocket.Conn
+	sessions      int
+	sessionID     string
+	subscriptions []string
+	chat          chan string
+	subscribed    chan string
+	messageID     int
+}
+
+func NewMockTwitch(t *testing.T) *MockTwitch {
+	m := &MockTwitch{
+		KeepaliveSeconds: 10,
+		KeepaliveEvery:   50 * time.Millisecond,
+		chat:             make(chan string, 64),
+		subscribed:       make(chan string, 8),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/device", m.serveDevice)
+	mux.HandleFunc("POST /oauth2/token", m.serveToken)
+	mux.HandleFunc("GET /oauth2/validate", m.serveValidate)
+	mux.HandleFunc("POST /helix/eventsub/subscriptions", m.serveSubscribe)
+	mux.HandleFunc("POST /helix/chat/messages", m.serveChat)
+	mux.HandleFunc("/ws", m.serveEventSub)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func (m *MockTwitch) Close() {
+	m.mu.Lock()
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.mu.Unlock()
+	m.Server.Close()
+}
+
+func (m *MockTwitch) EventSubURL() string {
+	return "ws" + strings.TrimPrefix(m.Server.URL, "http") + "/ws"
+}
+
+// A chat bot pointed at the mock with its credentials filled in.
+func (m *MockTwitch) NewChatBot() *ChatBot {
+	return &ChatBot{
+		UserID:        mockBotID,
+		ClientID:      mockClientID,
+		BroadcasterID: mockBroadcaster,
+		CommandPrefix: '!',
+		AuthURL:       m.Server.URL,
+		APIURL:        m.Server.URL,
+		EventSubURL:   m.EventSubURL(),
+		keepalive:     EventSubWelcomeTimeout,
+		clientSecret:  "mock-secret",
+	}
+}
+
+func (m *MockTwitch) authorized(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "Bearer "+mockAccessToken &&
+		r.Header.Get("Client-ID") == mockClientID
+}
+
+func (m *MockTwitch) serveDevice(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(JSONDeviceCode{
+		DeviceCode:      "mock-device",
+		ExpiresIn:       1800,
+		Interval:        1,
+		UserCode:        "MOCKCODE",
+		VerificationURI: m.Server.URL + "/activate",
+	})
+}
+
+func (m *MockTwitch) serveToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if r.Form.Get("client_id") != mockClientID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "invalid client"})
+		return
+	}
+	switch r.Form.Get("grant_type") {
+	case "authorization_code", "refresh_token", "client_credentials", DeviceGrantType:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "unsupported grant type"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  mockAccessToken,
+		"refresh_token": "mock-refresh",
+		"expires_in":    14400,
+		"scope":         BotScopes,
+		"token_type":    "bearer",
+	})
+}
+
+func (m *MockTwitch) serveValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "OAuth "+mockAccessToken &&
+		r.Header.Get("Authorization") != "Bearer "+mockAccessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(JSONTokenValidation{
+		ClientID:  mockClientID,
+		Login:     "goblinbot",
+		Scopes:    BotScopes,
+		UserID:    mockBotID,
+		ExpiresIn: 14400,
+	})
+}
+
+func (m *MockTwitch) serveSubscribe(w http.ResponseWriter, r *http.Request) {
+	if !m.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	sub := struct {
+		Type      string `json:"type"`
+		Transport struct {
+			SessionID string `json:"session_id"`
+		} `json:"transport"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&sub)
+
+	m.mu.Lock()
+	valid := sub.Transport.SessionID == m.sessionID
+	if valid {
+		m.subscriptions = append(m.subscriptions, sub.Type)
+	}
+	m.mu.Unlock()
+
+	if !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(JSONErrorResponse{Status: 400, Message: "session does not exist"})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, `{"data":[{"id":"sub-1","status":"enabled","type":%q}]}`, sub.Type)
+	m.subscribed <- sub.Type
+}
+
+func (m *MockTwitch) serveChat(w http.ResponseWriter, r *http.Request) {
+	if !m.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	msg := struct {
+		BroadcasterID string `json:"broadcaster_id"`
+		SenderID      string `json:"sender_id"`
+		Message       string `json:"message"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&msg)
+	if msg.SenderID != mockBotID || msg.BroadcasterID != mockBroadcaster || len(msg.Message) > ChatMessageMax {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, `{"data":[{"message_id":"chat-1","is_sent":true}]}`)
+	m.chat <- msg.Message
+}
+
+// New connections start a new session unless they follow a reconnect URL.
+func (m *MockTwitch) serveEventSub(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	m.mu.Lock()
+	old := m.conn
+	m.conn = c
+	if r.URL.Query().Get("reconnect") == "" {
+		m.sessions++
+		m.sessionID = fmt.Sprint("mock-session-", m.sessions)
+		m.subscriptions = nil
+	}
+	sessionID := m.sessionID
+	m.mu.Unlock()
+
+	m.write(c, map[string]any{
+		"metadata": m.metadata("session_welcome", ""),
+		"payload": map[string]any{"session": map[string]any{
+			"id":                        sessionID,
+			"status":                    "connected",
+			"keepalive_timeout_seconds": m.KeepaliveSeconds,
+		}},
+	})
+	if old != nil && r.URL.Query().Get("reconnect") != "" {
+		// Twitch drops the old connection once the new one is welcomed.
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			old.Close()
+		}()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(m.KeepaliveEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.write(c, map[string]any{
+					"metadata": m.metadata("session_keepalive", ""),
+					"payload":  map[string]any{},
+				})
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (m *MockTwitch) metadata(msgType string, subType string) map[string]any {
+	m.mu.Lock()
+	m.messageID++
+	id := m.messageID
+	m.mu.Unlock()
+
+	meta := map[string]any{
+		"message_id":        fmt.Sprint("mock-message-", id),
+		"message_type":      msgType,
+		"message_timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if subType != "" {
+		meta["subscription_type"] = subType
+		meta["subscription_version"] = "1"
+	}
+	return meta
+}
+
+func (m *MockTwitch) write(c *websocket.Conn, v any) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	c.WriteJSON(v)
+}
+
+func (m *MockTwitch) current() *websocket.Conn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conn
+}
+
+// Deliver a channel.chat.message notification as if a viewer typed text.
+func (m *MockTwitch) Chat(userID string, login string, text string) {
+	m.write(m.current(), map[string]any{
+		"metadata": m.metadata("notification", "channel.chat.message"),
+		"payload": map[string]any{
+			"subscription": map[string]any{
+				"id":      "sub-1",
+				"type":    "channel.chat.message",
+				"version": "1",
+				"status":  "enabled",
+			},
+			"event": map[string]any{
+				"broadcaster_user_id": mockBroadcaster,
+				"chatter_user_id":     userID,
+				"chatter_user_login":  strings.ToLower(login),
+				"chatter_user_name":   login,
+				"message_id":          fmt.Sprint("chat-", userID, "-", time.Now().UnixNano()),
+				"message_type":        "text",
+				"badges":              []any{},
+				"message": map[string]any{
+					"text":      text,
+					"fragments": []any{map[string]any{"type": "text", "text": text}},
+				},
+			},
+		},
+	})
+}
+
+// Ask the bot to move to a new connection on the same session.
+func (m *MockTwitch) Reconnect() {
+	m.mu.Lock()
+	sessionID := m.sessionID
+	m.mu.Unlock()
+
+	m.write(m.current(), map[string]any{
+		"metadata": m.metadata("session_reconnect", ""),
+		"payload": map[string]any{"session": map[string]any{
+			"id":            sessionID,
+			"status":        "reconnecting",
+			"reconnect_url": m.EventSubURL() + "?reconnect=1",
+		}},
+	})
+}
+
+func (m *MockTwitch) WaitForSubscription(t *testing.T) {
+	t.Helper()
+	select {
+	case <-m.subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot never subscribed to chat")
+	}
+}
+
+// Wait until the bot posts a chat line containing want.
+func (m *MockTwitch) WaitForChat(t *testing.T, want string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-m.chat:
+			if strings.Contains(msg, want) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("bot never said %q", want)
+		}
+	}
+}
+
+// Logs in with the device flow, then plays through the bot against the mock
+// from subscription to a vote in the dungeon, surviving a reconnect on the
+// way.
+func TestEndToEndMockTwitch(t *testing.T) {
+	DevicePollUnit = time.Millisecond
+	defer func() { DevicePollUnit = time.Second }()
+
+	mock := NewMockTwitch(t)
+	g := newTestGameServer(t)
+	b := mock.NewChatBot()
+	b.Attach(g)
+
+	err := b.GetDeviceAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go g.Run()
+	finished := make(chan struct{})
+	go func() {
+		b.Run()
+		close(finished)
+	}()
+
+	mock.WaitForSubscription(t)
+
+	mock.Chat("2001", "Alice", "!join")
+	mock.WaitForChat(t, "Alice joined the party!")
+
+	mock.Reconnect()
+	time.Sleep(200 * time.Millisecond)
+
+	mock.Chat("2002", "Bob", "!join")
+	mock.WaitForChat(t, "Bob joined the party!")
+
+	mock.Chat("2001", "Alice", "!begin")
+	msg := mock.WaitForChat(t, "The party of 2 descends")
+
+	// Chat lines may be merged, so the vote can come with the descent.
+	if !strings.Contains(msg, "Where to? !") {
+		msg = mock.WaitForChat(t, "Where to? !")
+	}
+	options := strings.Fields(msg[strings.Index(msg, "Where to? !")+len("Where to? "):])
+	dir := strings.TrimPrefix(options[0], "!")
+	mock.Chat("2001", "Alice", "!"+dir)
+	mock.Chat("2002", "Bob", "!"+dir)
+	mock.WaitForChat(t, "The party heads "+dir+".")
+
+	mock.Chat(mockBroadcaster, "Streamer", "!shutdown")
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot did not shut down")
+	}
+
+	mock.mu.Lock()
+	sessions := mock.sessions
+	mock.mu.Unlock()
+	if sessions != 1 {
+		t.Fatalf("bot opened %d sessions, want 1 across the reconnect", sessions)
+	}
+}
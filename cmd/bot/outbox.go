@@ -0,0 +1,221 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Flavor text
+	PriorityNormal                 // General game messages
+	PriorityHigh                   // Deaths, combat results
+	PriorityCount
+)
+
+const (
+	// Twitch rejects chat messages longer than this many characters.
+	ChatMessageMax = 500
+
+	// Messages merged into one chat line are joined with this.
+	OutboxSeparator = " | "
+
+	// Queued lines kept before the least important ones are dropped.
+	OutboxCapacity = 256
+
+	// How often the transport checks the outbox for something to send.
+	OutboxTick = 100 * time.Millisecond
+)
+
+// At most Messages may be sent in any window of length Per.
+type RateLimit struct {
+	Messages int
+	Per      time.Duration
+}
+
+// Twitch allows 20 messages per 30 seconds unless the bot is a moderator or
+// the broadcaster. A message short of the limit leaves room for mistakes.
+//
+// https://dev.twitch.tv/docs/chat/#rate-limits
+var ChatRateLimit = RateLimit{Messages: 19, Per: 30 * time.Second}
+
+// A prioritized queue of outbound chat lines shared by the game server and a
+// transport. Push never blocks, so the game tick is never held up by chat.
+// Pop merges short messages into one line and honors the rate limit.
+type Outbox struct {
+	mu     sync.Mutex
+	queues [PriorityCount][]string
+
+	limit RateLimit
+	sent  []time.Time // Send times inside the current window, oldest first
+}
+
+// An outbox with no rate limit until SetRateLimit is called.
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) SetRateLimit(limit RateLimit) {
+	o.mu.Lock()
+	o.limit = limit
+	o.sent = make([]time.Time, 0, limit.Messages)
+	o.mu.Unlock()
+}
+
+// Queue a message. Text longer than a chat line is split at word boundaries.
+// If the outbox is full the oldest, least important line is dropped.
+func (o *Outbox) Push(p Priority, m string) {
+	if o == nil {
+		return
+	}
+	m = strings.TrimSpace(m)
+	if m == "" {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, line := range SplitChatMessage(m, ChatMessageMax) {
+		if o.lenLocked() >= OutboxCapacity && !o.dropLocked(p) {
+			log.Println("outbox: Full. Dropped:", line)
+			continue
+		}
+		o.queues[p] = append(o.queues[p], line)
+	}
+}
+
+// Returns the next chat line to send, or false if the outbox is empty or the
+// rate limit would be exceeded. Higher priority lines always go first and
+// queued lines are merged while they fit in one chat message.
+func (o *Outbox) Pop(now time.Time) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.lenLocked() == 0 || !o.allowLocked(now) {
+		return "", false
+	}
+
+	var sb strings.Builder
+	length := 0
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		q := o.queues[p]
+		n := 0
+		for _, m := range q {
+			size := utf8.RuneCountInString(m)
+			if length > 0 {
+				size += len(OutboxSeparator)
+			}
+			if length+size > ChatMessageMax {
+				break
+			}
+			if length > 0 {
+				sb.WriteString(OutboxSeparator)
+			}
+			sb.WriteString(m)
+			length += size
+			n++
+		}
+		o.queues[p] = q[n:]
+		if n < len(q) {
+			break
+		}
+	}
+
+	if o.limit.Messages > 0 {
+		o.sent = append(o.sent, now)
+	}
+
+	return sb.String(), true
+}
+
+// Number of queued messages before merging.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.lenLocked()
+}
+
+func (o *Outbox) lenLocked() int {
+	n := 0
+	for _, q := range o.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Sliding window rate limit. Forget sends older than the window, then check
+// whether another fits.
+func (o *Outbox) allowLocked(now time.Time) bool {
+	if o.limit.Messages <= 0 {
+		return true
+	}
+	cutoff := now.Add(-o.limit.Per)
+	expired := 0
+	for expired < len(o.sent) && !o.sent[expired].After(cutoff) {
+		expired++
+	}
+	o.sent = o.sent[expired:]
+	return len(o.sent) < o.limit.Messages
+}
+
+// Make room by dropping the oldest line with priority at most p.
+func (o *Outbox) dropLocked(p Priority) bool {
+	for lower := PriorityLow; lower <= p; lower++ {
+		if len(o.queues[lower]) > 0 {
+			log.Println("outbox: Full. Dropped:", o.queues[lower][0])
+			o.queues[lower] = o.queues[lower][1:]
+			return true
+		}
+	}
+	return false
+}
+
+// Split text into lines of at most max characters, breaking between words.
+// Words longer than a whole line are broken wherever they must be.
+func SplitChatMessage(m string, max int) []string {
+	if utf8.RuneCountInString(m) <= max {
+		return []string{m}
+	}
+
+	lines := make([]string, 0, 2)
+	var sb strings.Builder
+	length := 0
+
+	flush := func() {
+		if length > 0 {
+			lines = append(lines, sb.String())
+			sb.Reset()
+			length = 0
+		}
+	}
+
+	for _, word := range strings.Fields(m) {
+		runes := []rune(word)
+		for len(runes) > max {
+			flush()
+			lines = append(lines, string(runes[:max]))
+			runes = runes[max:]
+		}
+		size := len(runes)
+		if length > 0 && length+1+size > max {
+			flush()
+		}
+		if length > 0 {
+			sb.WriteByte(' ')
+			length++
+		}
+		sb.WriteString(string(runes))
+		length += size
+	}
+	flush()
+
+	return lines
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplitChatMessage(t *testing.T) {
+	words := strings.Repeat("goblin ", 200)
+	lines := SplitChatMessage(words, ChatMessageMax)
+	if len(lines) < 3 {
+		t.Fatalf("expected at least 3 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) > ChatMessageMax {
+			t.Fatalf("line of %d characters exceeds the limit", len(line))
+		}
+		if strings.HasPrefix(line, " ") || strings.HasSuffix(line, " ") {
+			t.Fatalf("line %q was not split at a word boundary", line)
+		}
+		for _, w := range strings.Fields(line) {
+			if w != "goblin" {
+				t.Fatalf("word %q was cut in half", w)
+			}
+		}
+	}
+
+	long := strings.Repeat("a", ChatMessageMax+10)
+	lines = SplitChatMessage("hi "+long, ChatMessageMax)
+	if len(lines) != 3 || lines[0] != "hi" || len(lines[2]) != 10 {
+		t.Fatalf("unexpected split of an overlong word: %v", lines)
+	}
+}
+
+func TestOutboxPriorityAndMerge(t *testing.T) {
+	o := NewOutbox()
+	o.Push(PriorityLow, "A draft whistles through the corridor.")
+	o.Push(PriorityNormal, "Bob joined the party!")
+	o.Push(PriorityHigh, "Gob has died!")
+
+	m, ok := o.Pop(time.Now())
+	if !ok {
+		t.Fatal("outbox was empty")
+	}
+	want := "Gob has died! | Bob joined the party! | A draft whistles through the corridor."
+	if m != want {
+		t.Fatalf("got %q, want %q", m, want)
+	}
+	if o.Len() != 0 {
+		t.Fatalf("%d messages left after merge", o.Len())
+	}
+
+	o.Push(PriorityLow, strings.Repeat("x", 300))
+	o.Push(PriorityHigh, strings.Repeat("y", 300))
+	m, _ = o.Pop(time.Now())
+	if m[0] != 'y' || len(m) != 300 {
+		t.Fatal("high priority line should be sent alone first")
+	}
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	o := NewOutbox()
+	o.SetRateLimit(RateLimit{Messages: 2, Per: 30 * time.Second})
+
+	now := time.Now()
+	for range 3 {
+		o.Push(PriorityNormal, strings.Repeat("z", ChatMessageMax))
+	}
+
+	if _, ok := o.Pop(now); !ok {
+		t.Fatal("first send should be allowed")
+	}
+	if _, ok := o.Pop(now.Add(time.Second)); !ok {
+		t.Fatal("second send should be allowed")
+	}
+	if _, ok := o.Pop(now.Add(29 * time.Second)); ok {
+		t.Fatal("third send inside the window should be refused")
+	}
+	if _, ok := o.Pop(now.Add(31 * time.Second)); !ok {
+		t.Fatal("send after the window should be allowed")
+	}
+}
+
+func TestOutboxNeverBlocks(t *testing.T) {
+	o := NewOutbox()
+	for range OutboxCapacity * 2 {
+		o.Push(PriorityLow, "flavor")
+	}
+	o.Push(PriorityHigh, "important")
+	if o.Len() != OutboxCapacity {
+		t.Fatalf("outbox holds %d lines, want %d", o.Len(), OutboxCapacity)
+	}
+	m, _ := o.Pop(time.Now())
+	if !strings.HasPrefix(m, "important") {
+		t.Fatalf("high priority line was dropped: %q", m)
+	}
+}
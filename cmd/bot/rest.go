@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// How long a rest lasts.
+	RestWait = 20 * time.Second
+
+	// Members heal 1 HP this many times over a rest.
+	RestHeals = 4
+
+	// Chance of a wandering monster per dungeon level, and per rest
+	// already taken this delve. The dungeon notices loitering goblins.
+	AmbushPerLevel = 0.10
+	AmbushPerRest  = 0.15
+	AmbushMax      = 0.90
+)
+
+type Rest struct {
+	Ends     time.Time
+	NextHeal time.Time
+	AmbushAt time.Time // Zero if no monster comes
+}
+
+func (g *GameServer) AmbushChance() float64 {
+	d := g.Delve
+	return min(AmbushMax, AmbushPerLevel*float64(d.Level)+AmbushPerRest*float64(d.Rests))
+}
+
+// Rest instead of voting on the next room. Only possible out of combat.
+func (g *GameServer) StartRest(cmd Command, now time.Time) {
+	d := g.Delve
+	if d == nil || !g.Party.IsMember(cmd.UserID) {
+		return
+	}
+	if d.Vote == nil {
+		g.Say(PriorityNormal, "@"+cmd.Name()+" there is no time to rest now!")
+		return
+	}
+
+	d.Vote = nil
+	r := &Rest{
+		Ends:     now.Add(g.RestWait),
+		NextHeal: now.Add(g.RestWait / RestHeals),
+	}
+	if g.Rand.Float64() < g.AmbushChance() {
+		r.AmbushAt = now.Add(time.Duration(g.Rand.Int64N(int64(g.RestWait))))
+	}
+	d.Rest = r
+	d.Rests++
+
+	m := fmt.Sprintf("%s calls for a rest. The party settles down for %d seconds.",
+		cmd.Name(), int(g.RestWait.Seconds()))
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+}
+
+func (g *GameServer) UpdateRest(now time.Time) {
+	d := g.Delve
+	r := d.Rest
+
+	if !r.AmbushAt.IsZero() && !now.Before(r.AmbushAt) {
+		d.Rest = nil
+		m, err := g.PickMonster(d.Level)
+		if err != nil {
+			log.Println("game:", err)
+			g.OpenVote(now)
+			return
+		}
+		g.Say(PriorityHigh, "A wandering "+m.Name+" stumbles upon the resting party!")
+		g.StartCombat(m, false, true, now)
+		return
+	}
+
+	for !now.Before(r.NextHeal) && !r.NextHeal.After(r.Ends) {
+		r.NextHeal = r.NextHeal.Add(g.RestWait / RestHeals)
+		g.HealParty(1)
+	}
+
+	if !now.Before(r.Ends) {
+		d.Rest = nil
+		g.Say(PriorityNormal, "The party gets back on its feet.")
+		g.OpenVote(now)
+	}
+}
+
+// Heal everyone still alive.
+func (g *GameServer) HealParty(hp int) {
+	for _, uid := range g.Party.Members {
+		g.Heal(uid, hp)
+	}
+}
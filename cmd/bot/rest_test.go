@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestHeals(t *testing.T) {
+	g, now := newTestDelve(t)
+	g.Delve.Level = 0 // No wandering monsters on the first rest
+
+	alice := g.Party.PlayerCharacters["1"]
+	alice.HP, alice.HPMax, alice.Vitality = 0, 4, Downed
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "2", "Bob", "!rest", now)
+	if g.Delve.Rest == nil || g.Delve.Vote != nil || g.Delve.Rests != 1 {
+		t.Fatal("rest should replace the vote")
+	}
+
+	g.Update(now.Add(g.RestWait / 2))
+	if pc := g.Party.PlayerCharacters["1"]; pc.HP != 2 || pc.Vitality != Alive {
+		t.Fatalf("Alice should be halfway healed and up: %+v", pc)
+	}
+	g.Update(now.Add(g.RestWait))
+	if pc := g.Party.PlayerCharacters["1"]; pc.HP != pc.HPMax {
+		t.Fatalf("Alice should be fully healed: %+v", pc)
+	}
+	if g.Delve.Rest != nil || g.Delve.Vote == nil {
+		t.Fatal("vote should reopen after the rest")
+	}
+}
+
+func TestRestOnlyOutOfCombat(t *testing.T) {
+	g, now := newTestCombat(t, testMonster())
+
+	sendCommand(t, g, "1", "Alice", "!rest", now)
+	if g.Delve.Rest != nil {
+		t.Fatal("rested in the middle of combat")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "no time to rest") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestAmbushChanceGrows(t *testing.T) {
+	g, _ := newTestDelve(t)
+
+	first := g.AmbushChance()
+	g.Delve.Rests = 2
+	rested := g.AmbushChance()
+	g.Delve.Level = 3
+	deeper := g.AmbushChance()
+	if first <= 0 || rested <= first || deeper <= rested {
+		t.Fatalf("ambush chance %.2f, %.2f, %.2f should grow", first, rested, deeper)
+	}
+	g.Delve.Level, g.Delve.Rests = 100, 100
+	if g.AmbushChance() > AmbushMax {
+		t.Fatal("ambush chance above the cap")
+	}
+}
+
+func TestRestAmbush(t *testing.T) {
+	g, now := newTestDelve(t)
+
+	// Tough enough that the monster's first strike cannot end the delve
+	for uid, pc := range g.Party.PlayerCharacters {
+		pc.HP, pc.HPMax = 100, 100
+		g.Party.PlayerCharacters[uid] = pc
+	}
+
+	sendCommand(t, g, "1", "Alice", "!rest", now)
+	g.Delve.Rest.AmbushAt = now.Add(time.Second)
+	g.Update(now.Add(time.Second))
+
+	if g.Delve == nil || g.Delve.Rest != nil || g.Delve.Combat == nil {
+		t.Fatal("ambush should interrupt the rest with combat")
+	}
+	chat := drainChat(g)
+	if !strings.Contains(chat, "stumbles upon the resting party") {
+		t.Fatalf("ambush should be announced:\n%s", chat)
+	}
+	if !strings.Contains(chat, "strikes first") {
+		t.Fatalf("monster should have the initiative:\n%s", chat)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The shop buys back goblin junk at this fraction of its value.
+const SellFraction = 0.5
+
+// The shop's stock turns over at midnight UTC.
+func ShopDay(now time.Time) int64 {
+	return now.UTC().Unix() / int64(24*time.Hour/time.Second)
+}
+
+func ShopOwner(day int64) Owner {
+	return Owner{Type: OwnerShop, ID: day}
+}
+
+func SellPrice(item Item) int {
+	return int(float64(item.Value) * SellFraction)
+}
+
+// Goblins in the dungeon are a long way from the shops.
+func (g *GameServer) InTown(uid string) bool {
+	return g.Delve == nil || !g.Party.IsMember(uid)
+}
+
+func (g *GameServer) Shinies(pc Character) (int, error) {
+	var shinies int
+	err := g.Query[QueryShinies].QueryRow(pc.ID).Scan(&shinies)
+	if err != nil {
+		return 0, fmt.Errorf("shinies of %s: %w", pc.Name, err)
+	}
+	return shinies, nil
+}
+
+// Today's stock, put out if this is the first look of the day.
+func (g *GameServer) ShopStock(now time.Time) ([]Item, error) {
+	day := ShopDay(now)
+	if err := StockShop(g.DB, day); err != nil {
+		return nil, err
+	}
+	return g.Inventory(ShopOwner(day))
+}
+
+func (g *GameServer) Shop(cmd Command, now time.Time) {
+	pc, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	stock, err := g.ShopStock(now)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	shinies, err := g.Shinies(pc)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	if len(stock) == 0 {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s the shop is sold out. You have %d shinies.", pc.Name, shinies))
+		return
+	}
+
+	wares := make([]string, len(stock))
+	for i, item := range stock {
+		wares[i] = fmt.Sprintf("%s %ds", pc.ItemName(item), item.Value)
+		if item.Count > 1 {
+			wares[i] += fmt.Sprintf(" x%d", item.Count)
+		}
+	}
+	g.Say(PriorityNormal, fmt.Sprintf("@%s the shop has %s. You have %d shinies. !buy [item]",
+		pc.Name, strings.Join(wares, ", "), shinies))
+}
+
+func (g *GameServer) Buy(cmd Command, now time.Time) {
+	pc, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	stock, err := g.ShopStock(now)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	item, _, suggestions := g.ParseItem(pc, stock, cmd.RawArgs)
+	if item.ID == 0 {
+		if len(suggestions) == 0 {
+			g.Shop(cmd, now)
+			return
+		}
+		g.DidYouMean(cmd, "!buy ", suggestions)
+		return
+	}
+
+	err = BuyItem(g.DB, pc.ID, ShopOwner(ShopDay(now)), item.ID, item.Value)
+	if errors.Is(err, ErrTooPoor) {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s the %s costs %d shinies.", pc.Name, pc.ItemName(item), item.Value))
+		return
+	} else if errors.Is(err, ErrCarryFull) {
+		g.Say(PriorityNormal, "@"+pc.Name+" cannot carry any more.")
+		return
+	} else if errors.Is(err, ErrNoItem) {
+		g.Say(PriorityNormal, "@"+pc.Name+" the "+pc.ItemName(item)+" is sold out.")
+		return
+	} else if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	m := fmt.Sprintf("%s buys the %s for %d shinies.", pc.Name, pc.ItemName(item), item.Value)
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+}
+
+func (g *GameServer) Sell(cmd Command, now time.Time) {
+	pc, err := g.Character(cmd.UserID)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	items, err := g.Inventory(CharacterOwner(pc.ID))
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	item, _, suggestions := g.ParseItem(pc, items, cmd.RawArgs)
+	if item.ID == 0 {
+		g.UnknownItem(pc, items, "!sell ", suggestions)
+		return
+	}
+	price := SellPrice(item)
+	if price <= 0 {
+		g.Say(PriorityNormal, "@"+pc.Name+" the shopkeeper will not pay for the "+pc.ItemName(item)+".")
+		return
+	}
+
+	// Today's stock must be out first, or it would sweep the sale away.
+	if _, err := g.ShopStock(now); err != nil {
+		log.Println("game:", err)
+		return
+	}
+	err = SellItem(g.DB, pc.ID, ShopOwner(ShopDay(now)), item.ID, price)
+	if err != nil {
+		log.Println("game:", err)
+		return
+	}
+	m := fmt.Sprintf("%s sells the %s for %d shinies.", pc.Name, pc.ItemName(item), price)
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+}
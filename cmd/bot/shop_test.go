@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shopShelf(t *testing.T, g *GameServer, day int64) []string {
+	t.Helper()
+	if err := StockShop(g.DB, day); err != nil {
+		t.Fatal(err)
+	}
+	stock, err := g.Inventory(ShopOwner(day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shelf := make([]string, len(stock))
+	for i, item := range stock {
+		shelf[i] = fmt.Sprintf("%s x%d", item.Name, item.Count)
+	}
+	return shelf
+}
+
+func TestShopStockIsDailyAndSeeded(t *testing.T) {
+	g := newTestGameServer(t)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+
+	today := shopShelf(t, g, 100)
+	if len(today) == 0 || len(today) > ShopStockSize {
+		t.Fatalf("stocked %v", today)
+	}
+	if again := shopShelf(t, g, 100); !slices.Equal(today, again) {
+		t.Fatalf("restocked the same day: %v then %v", today, again)
+	}
+
+	changed := false
+	for day := int64(101); day < 110; day++ {
+		changed = changed || !slices.Equal(today, shopShelf(t, g, day))
+	}
+	if !changed {
+		t.Fatal("the stock never changes")
+	}
+
+	// Wiping the shelf and stocking the day again puts out the same goods.
+	if _, err := g.DB.Exec("DELETE FROM ShopDay"); err != nil {
+		t.Fatal(err)
+	}
+	if again := shopShelf(t, g, 100); !slices.Equal(today, again) {
+		t.Fatalf("stock is not deterministic: %v then %v", today, again)
+	}
+	var old int
+	err := g.DB.QueryRow("SELECT COUNT(*) FROM ItemInstance WHERE owner_type = 'shop' AND owner_id != 100").Scan(&old)
+	if err != nil || old != 0 {
+		t.Fatalf("%d stale stacks left: %v", old, err)
+	}
+}
+
+func TestBuyAndSell(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.db")
+	g := NewGameServerWithDB(path)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	sendCommand(t, g, "1", "Alice", "!shop", now)
+	if chat := drainChat(g); !strings.Contains(chat, "You have 0 shinies. !buy [item]") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	alice, err := g.LoadCharacter("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stock, err := g.ShopStock(now)
+	if err != nil || len(stock) == 0 {
+		t.Fatalf("no stock: %v", err)
+	}
+	item := slices.MaxFunc(stock, func(a, b Item) int { return a.Value - b.Value })
+
+	buy := "!buy " + alice.ItemName(item)
+	sendCommand(t, g, "1", "Alice", buy, now)
+	if chat := drainChat(g); !strings.Contains(chat, fmt.Sprintf("costs %d shinies", item.Value)) {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	if err := AwardCharacter(g.DB, alice.ID, item.Value, 0); err != nil {
+		t.Fatal(err)
+	}
+	sendCommand(t, g, "1", "Alice", buy, now)
+	if chat := drainChat(g); !strings.Contains(chat, "Alice buys the") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if shinies, _ := g.Shinies(alice); shinies != 0 {
+		t.Fatalf("Alice has %d shinies left", shinies)
+	}
+	bag, err := g.Inventory(CharacterOwner(alice.ID))
+	if err != nil || len(bag) != 1 || bag[0].ID != item.ID {
+		t.Fatalf("bag %v: %v", bag, err)
+	}
+
+	// The shelf stays as bare after a restart.
+	CloseQuery(g.Query)
+	g.DB.Close()
+	g = NewGameServerWithDB(path)
+	defer g.DB.Close()
+	defer CloseQuery(g.Query)
+	after, err := g.ShopStock(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := 0
+	for _, it := range after {
+		if it.ID == item.ID {
+			left = it.Count
+		}
+	}
+	if left != item.Count-1 {
+		t.Fatalf("stock of %s went from %d to %d", item.Name, item.Count, left)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!sell "+alice.ItemName(bag[0]), now)
+	if chat := drainChat(g); !strings.Contains(chat, "Alice sells the") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if shinies, _ := g.Shinies(alice); shinies != SellPrice(item) {
+		t.Fatalf("Alice got %d shinies, want %d", shinies, SellPrice(item))
+	}
+	if bag, _ := g.Inventory(CharacterOwner(alice.ID)); len(bag) != 0 {
+		t.Fatalf("still carrying %v", bag)
+	}
+}
+
+func TestShopOnlyInTown(t *testing.T) {
+	g, now := newTestDelve(t)
+
+	sendCommand(t, g, "1", "Alice", "!shop", now)
+	if chat := drainChat(g); !strings.Contains(chat, "Goblin Town") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	var stocked int
+	if err := g.DB.QueryRow("SELECT COUNT(*) FROM ShopDay").Scan(&stocked); err != nil || stocked != 0 {
+		t.Fatal("the shop opened in the dungeon")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type Spell struct {
+	ID          int
+	Name        string
+	Will        int // Cost to cast
+	Level       int
+	Description string
+	Effects     []Effect
+}
+
+func (g *GameServer) LoadSpell(id int) (Spell, error) {
+	s := Spell{ID: id}
+	err := g.Query[QuerySpell].QueryRow(id).Scan(&s.Name, &s.Will, &s.Level, &s.Description)
+	if err != nil {
+		return s, fmt.Errorf("load spell %d: %w", id, err)
+	}
+	s.Effects, err = g.LoadEffects(QuerySpellEffects, id)
+	if err != nil {
+		return s, fmt.Errorf("load spell %d: %w", id, err)
+	}
+	return s, nil
+}
+
+// Effects of a spell or item, in order. q is the query listing them by owner.
+func (g *GameServer) LoadEffects(q int, id int) ([]Effect, error) {
+	rows, err := g.Query[q].Query(id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	effects := make([]Effect, 0, 2)
+	for rows.Next() {
+		var e Effect
+		err = rows.Scan(&e.Kind, &e.Target, &e.Dice, &e.Stat, &e.Rounds)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, e)
+	}
+	return effects, rows.Err()
+}
+
+// Spells a character knows.
+func (g *GameServer) KnownSpells(characterID int) ([]Spell, error) {
+	rows, err := g.Query[QueryCharacterSpells].Query(characterID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, 4)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	spells := make([]Spell, 0, len(ids))
+	for _, id := range ids {
+		s, err := g.LoadSpell(id)
+		if err != nil {
+			return nil, err
+		}
+		spells = append(spells, s)
+	}
+	return spells, nil
+}
+
+func (c Character) SpellNames() []string {
+	names := make([]string, len(c.Spells))
+	for i, s := range c.Spells {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func (c Character) Spell(name string) (Spell, bool) {
+	for _, s := range c.Spells {
+		if s.Name == name || (name == "" && s.ID == c.Prepared) {
+			return s, true
+		}
+	}
+	return Spell{}, false
+}
+
+// Split "spell [target]" into a known spell and the target's name.
+func (g *GameServer) ParseSpell(c Character, raw string) (Spell, string, []string) {
+	match, target, suggestions := SplitTarget(raw, c.SpellNames())
+	if match == "" {
+		return Spell{}, "", suggestions
+	}
+	s, _ := c.Spell(match)
+	return s, target, nil
+}
+
+// Ready a spell so that casting it later needs no Will check.
+func (g *GameServer) Prepare(uid string, raw string) {
+	pc := g.Party.PlayerCharacters[uid]
+	if len(pc.Spells) == 0 {
+		g.Say(PriorityNormal, pc.Name+" knows no spells.")
+		return
+	}
+	if raw == "" {
+		g.Say(PriorityNormal, "@"+pc.Name+" prepare which spell? "+strings.Join(pc.SpellNames(), ", "))
+		return
+	}
+
+	s, _, suggestions := g.ParseSpell(pc, raw)
+	if s.ID == 0 {
+		g.UnknownSpell(pc, "!prepare ", suggestions)
+		return
+	}
+	pc.Prepared = s.ID
+	g.Party.PlayerCharacters[uid] = pc
+	g.Say(PriorityNormal, pc.Name+" prepares "+s.Name+".")
+}
+
+// Cast the prepared spell, or name one. Casting costs Will, and casting a
+// spell that was not prepared needs a Will check as well.
+func (g *GameServer) Cast(uid string, raw string, now time.Time) {
+	pc := g.Party.PlayerCharacters[uid]
+	if len(pc.Spells) == 0 {
+		g.Say(PriorityNormal, pc.Name+" knows no spells.")
+		return
+	}
+
+	s, target, suggestions := g.ParseSpell(pc, raw)
+	if s.ID == 0 {
+		prepared, ok := pc.Spell("")
+		if !ok {
+			if raw == "" {
+				g.Say(PriorityNormal, pc.Name+" has no spell prepared.")
+			} else {
+				g.UnknownSpell(pc, "!cast ", suggestions)
+			}
+			return
+		}
+		s, target = prepared, raw
+	}
+
+	if g.Delve.Combat == nil && s.Effects[0].Target == TargetMonster {
+		g.Say(PriorityNormal, "There is nothing for "+pc.Name+" to cast "+s.Name+" at.")
+		return
+	}
+	if pc.Will < s.Will {
+		g.Say(PriorityNormal, pc.Name+" is too drained to cast "+s.Name+".")
+		return
+	}
+	unprepared := s.ID != pc.Prepared
+	pc.Will -= s.Will
+	pc.Prepared = 0
+	g.Party.PlayerCharacters[uid] = pc
+
+	if unprepared && !g.StatCheck(pc.Will+s.Will) {
+		g.Say(PriorityNormal, pc.Name+"'s "+s.Name+" fizzles!")
+		return
+	}
+
+	m := pc.Name + " casts " + s.Name + "!"
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+	g.ApplyEffects(s.Name, uid, target, s.Effects, now)
+}
+
+func (g *GameServer) UnknownSpell(pc Character, prefix string, suggestions []string) {
+	if len(suggestions) == 0 {
+		g.Say(PriorityNormal, "@"+pc.Name+" knows "+strings.Join(pc.SpellNames(), ", ")+".")
+		return
+	}
+	g.DidYouMean(Command{DisplayName: pc.Name}, prefix, suggestions)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestStartingSpells(t *testing.T) {
+	g, _ := newTestDelve(t)
+
+	alice := g.Party.PlayerCharacters["1"]
+	names := alice.SpellNames()
+	if strings.Join(names, ",") != "Spark,Mend,Glow" {
+		t.Fatalf("starting spells %v", names)
+	}
+	spark, _ := alice.Spell("Spark")
+	if spark.Will != 1 || len(spark.Effects) != 1 || spark.Effects[0].Kind != EffectDamage {
+		t.Fatalf("spark loaded wrong: %+v", spark)
+	}
+}
+
+func TestCastPreparedSpell(t *testing.T) {
+	g, now := newTestDelve(t)
+	sendCommand(t, g, "1", "Alice", "!prepare sprak", now)
+	if g.Party.PlayerCharacters["1"].Prepared == 0 {
+		t.Fatal("spell was not prepared")
+	}
+
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	g.Delve.Vote = nil
+	g.StartCombat(m, true, false, now)
+	drainChat(g)
+
+	sendCommand(t, g, "1", "Alice", "!cast", now)
+	sendCommand(t, g, "2", "Bob", "!taunt", now)
+
+	alice := g.Party.PlayerCharacters["1"]
+	if alice.Will != alice.WillMax-1 || alice.Prepared != 0 {
+		t.Fatalf("casting should cost Will and use up the prepared spell: %+v", alice)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "Alice casts Spark!") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if g.Delve.Combat.Monster.HP >= 100 {
+		t.Fatal("spark did no damage")
+	}
+}
+
+func TestCastNeedsWill(t *testing.T) {
+	g, now := newTestDelve(t)
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Will = 1
+	g.Party.PlayerCharacters["1"] = alice
+
+	sendCommand(t, g, "1", "Alice", "!cast mend", now)
+	if g.Party.PlayerCharacters["1"].Will != 1 {
+		t.Fatal("cast without enough Will")
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "too drained") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestUnpreparedCastChecksWill(t *testing.T) {
+	g, now := newTestDelve(t)
+	g.Rand = rand.New(rand.NewPCG(1, 2))
+
+	fizzles := 0
+	for range 40 {
+		alice := g.Party.PlayerCharacters["1"]
+		alice.Will = 2
+		g.Party.PlayerCharacters["1"] = alice
+		sendCommand(t, g, "1", "Alice", "!cast mend", now)
+		if strings.Contains(drainChat(g), "fizzles") {
+			fizzles++
+		}
+	}
+	if fizzles < 30 {
+		t.Fatalf("only %d of 40 casts fizzled on a Will of 2", fizzles)
+	}
+
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Will = 20
+	g.Party.PlayerCharacters["1"] = alice
+	sendCommand(t, g, "1", "Alice", "!cast mend", now)
+	if strings.Contains(drainChat(g), "fizzles") {
+		t.Fatal("fizzled on a Will of 20")
+	}
+}
+
+func TestMendRaisesDownedAlly(t *testing.T) {
+	g, now := newTestDelve(t)
+	alice := g.Party.PlayerCharacters["1"]
+	alice.Will = 20
+	g.Party.PlayerCharacters["1"] = alice
+	bob := g.Party.PlayerCharacters["2"]
+	bob.HP, bob.Vitality = 0, Downed
+	g.Party.PlayerCharacters["2"] = bob
+
+	sendCommand(t, g, "1", "Alice", "!cast mnd bbo", now)
+	if bob = g.Party.PlayerCharacters["2"]; bob.Vitality != Alive || bob.HP < 2 {
+		t.Fatalf("Bob should be healed and up: %+v", bob)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "Bob is back on their feet") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestSleepSkipsMonsterTurns(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	m.Attack = MustParseDice("10d10")
+	g, now := newTestCombat(t, m)
+
+	g.ApplyEffect("Snooze", "1", "", Effect{Kind: EffectSleep, Target: TargetMonster, Rounds: 2}, now)
+	for range 2 {
+		sendCommand(t, g, "1", "Alice", "!taunt", now)
+		sendCommand(t, g, "2", "Bob", "!taunt", now)
+	}
+	for _, uid := range g.Party.Members {
+		if pc := g.Party.PlayerCharacters[uid]; pc.HP != pc.HPMax {
+			t.Fatalf("a sleeping monster hurt %s", pc.Name)
+		}
+	}
+	if chat := drainChat(g); strings.Count(chat, "snores") != 2 {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+}
+
+func TestBuffsRunOut(t *testing.T) {
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	m.Attack = MustParseDice("1d1-1")
+	g, now := newTestCombat(t, m)
+	base := g.Party.PlayerCharacters["1"].Defense
+
+	bark := Effect{Kind: EffectBuff, Target: TargetSelf, Dice: "1d1+1", Stat: "defense", Rounds: 2}
+	g.ApplyEffect("Bark Skin", "1", "", bark, now)
+	if d := g.Party.PlayerCharacters["1"].Defense; d != base+2 {
+		t.Fatalf("defense %d, want %d", d, base+2)
+	}
+	for range 2 {
+		sendCommand(t, g, "1", "Alice", "!taunt", now)
+		sendCommand(t, g, "2", "Bob", "!taunt", now)
+	}
+	if d := g.Party.PlayerCharacters["1"].Defense; d != base {
+		t.Fatalf("defense %d after the buff ran out, want %d", d, base)
+	}
+
+	g.ApplyEffect("Bark Skin", "1", "", bark, now)
+	g.EndCombat()
+	if d := g.Party.PlayerCharacters["1"].Defense; d != base {
+		t.Fatalf("defense %d after the fight, want %d", d, base)
+	}
+}
+
+func TestGlowLightsTheWay(t *testing.T) {
+	g, now := newTestDelve(t)
+	sendCommand(t, g, "1", "Alice", "!prepare glow", now)
+	sendCommand(t, g, "1", "Alice", "!cast", now)
+	if g.Delve.Light != 3 {
+		t.Fatalf("light %d, want 3", g.Delve.Light)
+	}
+	drainChat(g)
+
+	m := testMonster()
+	m.HP, m.HPMax = 100, 100
+	m.Attack = MustParseDice("1d1-1")
+	for range 20 {
+		g.Delve.Vote = nil
+		g.StartCombat(m, false, true, now)
+		g.EndCombat()
+	}
+	if !strings.Contains(drainChat(g), "The party acts first") {
+		t.Fatal("a lit party was always caught unaware")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Approaches to a monster that has not noticed the party.
+const (
+	ApproachSneak  = "sneak"
+	ApproachSteal  = "steal"
+	ApproachAttack = "attack"
+)
+
+// Stealing is harder than sneaking. Each goblin's Agility counts for this
+// much less.
+const StealPenalty = 3
+
+// Sneaking past earns this fraction of the monster's XP. Stealing and
+// fighting earn all of it.
+const SneakXPDivisor = 2
+
+// The party has found a monster unaware and decides what to do about it.
+type Encounter struct {
+	Monster
+	Vote
+}
+
+func (g *GameServer) OpenEncounter(m Monster, now time.Time) {
+	options := []string{ApproachSneak, ApproachSteal, ApproachAttack}
+	if g.Delve.Room().Robbed {
+		options = []string{ApproachSneak, ApproachAttack}
+	}
+
+	g.Delve.Encounter = &Encounter{
+		Monster: m,
+		Vote: Vote{
+			Options:  options,
+			Ballots:  make(map[string]string, len(g.Party.Members)),
+			Default:  ApproachSneak,
+			Deadline: now.Add(g.VoteWait),
+		},
+	}
+
+	g.Say(PriorityNormal, fmt.Sprintf("A %s has not noticed the party. !%s (%ds)",
+		m.Name, strings.Join(options, " !"), int(g.VoteWait.Seconds())))
+}
+
+func (g *GameServer) ChooseApproach(cmd Command, now time.Time) {
+	e := g.Delve.Encounter
+	if !g.Party.IsMember(cmd.UserID) {
+		return
+	}
+	if !slices.Contains(e.Options, cmd.Verb) {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s there is nothing left to steal. Try !%s",
+			cmd.Name(), strings.Join(e.Options, " !")))
+		return
+	}
+	e.Ballots[cmd.UserID] = cmd.Verb
+
+	if e.Decided(len(g.Party.Members)) {
+		g.CloseEncounter(now)
+	}
+}
+
+// Everyone standing makes an Agility check. The party succeeds if most do.
+// Returns whether it did and the first goblin to succeed.
+func (g *GameServer) AgilityChecks(penalty int) (bool, string) {
+	standing := g.Standing()
+	passed := 0
+	first := ""
+	for _, uid := range standing {
+		if g.StatCheck(g.Party.PlayerCharacters[uid].Agility - penalty) {
+			passed++
+			if first == "" {
+				first = uid
+			}
+		}
+	}
+	return passed*2 > len(standing), first
+}
+
+func (g *GameServer) CloseEncounter(now time.Time) {
+	d := g.Delve
+	e := d.Encounter
+	d.Encounter = nil
+	m := e.Monster
+
+	switch e.Winner(g.Party.Leader) {
+	case ApproachAttack:
+		g.StartCombat(m, true, false, now)
+
+	case ApproachSneak:
+		ok, _ := g.AgilityChecks(0)
+		if !ok {
+			g.Say(PriorityHigh, "A goblin trips over their own feet. The "+m.Name+" wakes up!")
+			g.StartCombat(m, true, true, now)
+			return
+		}
+		d.EarnXP("sneaking", m.XP/SneakXPDivisor)
+		msg := "The party sneaks past the " + m.Name + "."
+		log.Println("game:", msg)
+		g.Say(PriorityNormal, msg)
+		g.OpenVote(now)
+
+	case ApproachSteal:
+		ok, thief := g.AgilityChecks(StealPenalty)
+		if !ok {
+			g.Say(PriorityHigh, "Caught red handed! The "+m.Name+" attacks!")
+			g.StartCombat(m, false, true, now)
+			return
+		}
+		d.EarnXP("stealing", m.XP)
+		d.Room().Robbed = true
+		msg := g.Party.Name(thief) + " robs the sleeping " + m.Name + "!"
+		log.Println("game:", msg)
+		g.Say(PriorityNormal, msg)
+		g.Loot(m, thief)
+		g.OpenVote(now)
+	}
+}
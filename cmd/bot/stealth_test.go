@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Alice and Bob in the first room with a sleeping monster.
+func newTestEncounter(t *testing.T, agility int) (*GameServer, *Room) {
+	t.Helper()
+	g, now := newTestDelve(t)
+	g.Delve.Vote = nil
+	for _, uid := range g.Party.Members {
+		pc := g.Party.PlayerCharacters[uid]
+		pc.Agility = agility
+		g.Party.PlayerCharacters[uid] = pc
+	}
+
+	m := testMonster()
+	m.XP = 10
+	room := g.Delve.Room()
+	room.Monster = true
+	g.OpenEncounter(m, now)
+	drainChat(g)
+	return g, room
+}
+
+func TestSneakPast(t *testing.T) {
+	g, room := newTestEncounter(t, 100)
+
+	sendCommand(t, g, "1", "Alice", "!sneak", time.Now())
+	sendCommand(t, g, "2", "Bob", "!sneak", time.Now())
+	if g.Delve.Encounter != nil || g.Delve.Combat != nil || g.Delve.Vote == nil {
+		t.Fatal("successful sneak should move on to the vote")
+	}
+	if g.Delve.BonusXP() != 10/SneakXPDivisor || !room.Monster {
+		t.Fatalf("bonus XP %d, monster still there: %v", g.Delve.BonusXP(), room.Monster)
+	}
+}
+
+func TestStealFromSleeping(t *testing.T) {
+	g, room := newTestEncounter(t, 100)
+
+	sendCommand(t, g, "1", "Alice", "!steal", time.Now())
+	sendCommand(t, g, "2", "Bob", "!sneak", time.Now())
+	if g.Delve.Combat != nil || !room.Robbed {
+		t.Fatal("leader's choice to steal should win the tie and succeed")
+	}
+	if g.Delve.BonusXP() != 10 || g.Delve.Shinies == 0 {
+		t.Fatalf("theft paid %d XP and %d shinies", g.Delve.BonusXP(), g.Delve.Shinies)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "robs the sleeping Giant Rat") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+
+	g.Delve.Vote = nil
+	g.OpenEncounter(testMonster(), time.Now())
+	sendCommand(t, g, "1", "Alice", "!steal", time.Now())
+	if _, ok := g.Delve.Encounter.Ballots["1"]; ok {
+		t.Fatal("a robbed monster cannot be robbed again")
+	}
+}
+
+func TestClumsyPartyWakesMonster(t *testing.T) {
+	g, _ := newTestEncounter(t, -100)
+
+	sendCommand(t, g, "1", "Alice", "!steal", time.Now())
+	sendCommand(t, g, "2", "Bob", "!steal", time.Now())
+	if g.Delve.Combat == nil || g.Delve.BonusXP() != 0 {
+		t.Fatal("failed theft should start combat without reward")
+	}
+}
+
+func TestEncounterAttackSurprises(t *testing.T) {
+	g, _ := newTestEncounter(t, 9)
+
+	sendCommand(t, g, "1", "Alice", "!attack", time.Now())
+	sendCommand(t, g, "2", "Bob", "!attack", time.Now())
+	c := g.Delve.Combat
+	if c == nil || c.Round != 1 || len(c.Choices) != 0 {
+		t.Fatal("attack vote should start combat with the party's turn")
+	}
+}
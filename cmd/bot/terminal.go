@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Plays the game from a terminal without Twitch. Every line typed is chat
+// from the current player. Prefix a line with "@name" to speak as someone
+// else, or enter "@name" alone to switch players. The terminal is the
+// broadcaster, so "!shutdown" and end of input stop the game.
+type Terminal struct {
+	In  io.Reader
+	Out io.Writer
+
+	CommandPrefix byte
+	Player        string
+
+	Outbox *Outbox // For getting messages from the game server
+
+	GameCommandOut chan Command // For sending commands to the game server
+	GameInterrupt  chan os.Signal
+	GameDone       chan struct{}
+}
+
+func NewTerminal() *Terminal {
+	return &Terminal{
+		In:            os.Stdin,
+		Out:           os.Stdout,
+		CommandPrefix: '!',
+		Player:        "designer",
+	}
+}
+
+func (t *Terminal) Attach(g *GameServer) {
+	t.Outbox = g.MessagesOut
+
+	t.GameCommandOut = g.CommandsIn
+	t.GameInterrupt = g.Interrupt
+	t.GameDone = g.Shutdown
+}
+
+// Local players are identified by name.
+func TerminalUserID(player string) string {
+	return "local:" + strings.ToLower(player)
+}
+
+// Returns false once the game has been told to shut down.
+func (t *Terminal) ProcessLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "@") {
+		name, rest, _ := strings.Cut(line[1:], " ")
+		if name == "" {
+			return true
+		}
+		if rest == "" {
+			t.Player = name
+			fmt.Fprintf(t.Out, "* Now playing as %s\n", name)
+			return true
+		}
+		return t.processCommand(name, strings.TrimSpace(rest))
+	}
+	return t.processCommand(t.Player, line)
+}
+
+func (t *Terminal) processCommand(player string, text string) bool {
+	cmd, ok := ParseCommand(t.CommandPrefix, text)
+	if !ok {
+		return true
+	}
+	cmd.UserID = TerminalUserID(player)
+	cmd.Login = strings.ToLower(player)
+	cmd.DisplayName = player
+	cmd.Badges = []string{"broadcaster"}
+	cmd.Timestamp = time.Now()
+
+	t.GameCommandOut <- cmd
+	return cmd.Verb != "shutdown"
+}
+
+// Print everything waiting in the outbox.
+func (t *Terminal) flush(now time.Time) {
+	for {
+		m, ok := t.Outbox.Pop(now)
+		if !ok {
+			return
+		}
+		fmt.Fprintln(t.Out, "bot>", m)
+	}
+}
+
+func (t *Terminal) Run() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(
+		interrupt,
+		syscall.SIGHUP,  // kill -SIGHUP XXXX
+		syscall.SIGINT,  // kill -SIGINT XXXX or Ctrl+c
+		syscall.SIGQUIT, // kill -SIGQUIT XXXX
+		syscall.SIGTERM, // kill -SIGTERM XXXX
+	)
+	defer signal.Reset()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(t.In)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			log.Println("terminal:", err)
+		}
+	}()
+
+	ticker := time.NewTicker(OutboxTick)
+	defer ticker.Stop()
+
+	alive := true
+
+	for alive {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// The game may already be gone, with no one left to listen.
+				select {
+				case t.GameCommandOut <- Command{Verb: "shutdown"}:
+				case <-t.GameDone:
+				}
+				alive = false
+				break
+			}
+			alive = t.ProcessLine(line)
+		case now := <-ticker.C:
+			t.flush(now)
+		case <-t.GameDone:
+			t.flush(time.Now())
+			return
+		case sig := <-interrupt:
+			log.Println("terminal: Interrupt received.")
+			t.GameInterrupt <- sig
+			alive = false
+		}
+	}
+
+	select {
+	case <-t.GameDone:
+	case <-time.After(time.Second):
+	}
+	t.flush(time.Now())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalTransport(t *testing.T) {
+	g := newTestGameServer(t)
+
+	var out bytes.Buffer
+	term := NewTerminal()
+	term.In = strings.NewReader("!join\n@bob !join\n@carl\n!join\nnot a command\n")
+	term.Out = &out
+	term.Attach(g)
+
+	go g.Run()
+
+	done := make(chan struct{})
+	go func() {
+		term.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("terminal did not shut down at end of input")
+	}
+
+	for _, name := range []string{"designer", "bob", "carl"} {
+		if !strings.Contains(out.String(), name+" joined the party!") {
+			t.Fatalf("missing join message for %s in output:\n%s", name, out.String())
+		}
+	}
+}
+
+func TestTerminalOutlivesGame(t *testing.T) {
+	gameDone := make(chan struct{})
+	term := NewTerminal()
+	term.In = strings.NewReader("")
+	term.Out = io.Discard
+	term.Outbox = NewOutbox()
+	term.GameCommandOut = make(chan Command) // No one is listening
+	term.GameDone = gameDone
+
+	done := make(chan struct{})
+	go func() {
+		term.Run()
+		close(done)
+	}()
+	time.AfterFunc(100*time.Millisecond, func() { close(gameDone) })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("terminal hung telling a stopped game to shut down")
+	}
+}
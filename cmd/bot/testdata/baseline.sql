@@ -0,0 +1,80 @@
+-- A game database as the first release made it: two goblins, the first
+-- carrying two potions and a shank in the old fixed inventory slots.
+CREATE TABLE CommandType (
+	id INTEGER PRIMARY KEY,
+	type TEXT UNIQUE NOT NULL
+) STRICT;
+INSERT INTO CommandType VALUES (1, 'admin'), (2, 'global'), (3, 'combat'), (4, 'explore');
+
+CREATE TABLE Command (
+	id INTEGER PRIMARY KEY,
+	command TEXT UNIQUE NOT NULL,
+	type_id INTEGER NOT NULL REFERENCES CommandType (id)
+) STRICT;
+INSERT INTO Command VALUES (1, 'inspect', 2), (2, 'join', 2), (3, 'sneak', 4), (4, 'attack', 3);
+
+CREATE TABLE ItemType (
+	id INTEGER PRIMARY KEY,
+	type TEXT UNIQUE NOT NULL
+) STRICT;
+INSERT INTO ItemType VALUES (1, 'empty'), (2, 'armor'), (3, 'weapon'), (4, 'consumable');
+
+CREATE TABLE Item (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	type_id INTEGER NOT NULL REFERENCES ItemType (id),
+	value INTEGER NOT NULL,
+	attack TEXT NOT NULL,
+	defense INTEGER NOT NULL,
+	description TEXT NOT NULL
+) STRICT;
+INSERT INTO Item VALUES
+	(1, 'empty', 1, 0, '', 0, 'Empty.'),
+	(2, 'Snotty Rags', 2, 0, '', 0, 'Filthy goblin rags worn by the lowliest of gits.'),
+	(3, 'Rusty Shank', 3, 1, '1d4', 0, 'Stabby!'),
+	(4, 'Potion of Grom''s Blood', 4, 50, '', 0, 'A blood red, bubbling brew. Smells like copper.');
+
+CREATE TABLE Inventory (
+	id INTEGER PRIMARY KEY,
+	parent_id INTEGER NOT NULL REFERENCES Character (id) ON DELETE CASCADE,
+	item_id_1 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_2 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_3 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_4 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_5 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_6 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_7 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_8 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_9 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1,
+	item_id_10 INTEGER NOT NULL REFERENCES Item (id) DEFAULT 1
+) STRICT;
+INSERT INTO Inventory (parent_id, item_id_1, item_id_3, item_id_5) VALUES (1, 4, 4, 3);
+INSERT INTO Inventory (parent_id) VALUES (2);
+
+CREATE TABLE Character (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+
+	user_id INTEGER NOT NULL REFERENCES User (id) ON DELETE CASCADE,
+	armor_id INTEGER NOT NULL REFERENCES Item (id),
+	weapon_id INTEGER NOT NULL REFERENCES Item (id),
+
+	level INTEGER NOT NULL,
+	experience INTEGER NOT NULL,
+	shinies INTEGER NOT NULL,
+
+	might INTEGER NOT NULL,
+	agility INTEGER NOT NULL,
+	will INTEGER NOT NULL,
+
+	hp INTEGER NOT NULL
+) STRICT;
+INSERT INTO Character VALUES
+	(1, '1001', 1, 1, 1, 1, 0, 0, 9, 9, 9, 4),
+	(2, '1002', 2, 1, 1, 1, 0, 0, 9, 9, 9, 4);
+
+CREATE TABLE User (
+	id INTEGER PRIMARY KEY,
+	twitch_id TEXT UNIQUE NOT NULL
+) STRICT;
+INSERT INTO User VALUES (1, '1001'), (2, '1002');
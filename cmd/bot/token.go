@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Refresh the user token when it is this close to expiring.
+	TokenRefreshMargin = 5 * time.Minute
+
+	// Twitch requires apps to validate tokens on startup and hourly.
+	TokenValidateInterval = time.Hour
+)
+
+var ErrTokenInvalid = errors.New("token: invalid or expired access token")
+
+// Error body returned by the token endpoint for a rejected grant.
+type TokenError struct {
+	Status  int
+	Message string
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("token: %d %s", e.Status, e.Message)
+}
+
+type UserToken struct {
+	oauth2.Token
+	Scope []string `json:"scope"`
+}
+
+// Stamp the absolute expiry from the relative expires_in returned by Twitch.
+func (t *UserToken) SetExpiry(now time.Time) {
+	if t.ExpiresIn > 0 {
+		t.Expiry = now.Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+}
+
+// True if the token expires within TokenRefreshMargin of now. Tokens
+// without a known expiry are never considered stale.
+func (t *UserToken) NeedsRefresh(now time.Time) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return now.Add(TokenRefreshMargin).After(t.Expiry)
+}
+
+// Read a previously saved user token from disk.
+func LoadUserToken(path string) (*UserToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &UserToken{}
+	err = json.Unmarshal(data, t)
+	if err != nil {
+		return nil, err
+	}
+	if t.AccessToken == "" {
+		return nil, ErrTokenInvalid
+	}
+	return t, nil
+}
+
+// Write the user token to disk, readable only by the owner. The file is
+// written beside the target and renamed so a crash never leaves half a token.
+func SaveUserToken(path string, t *UserToken) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	err = tmp.Chmod(0600)
+	if err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Install a new user token and persist it so restarts can reuse it.
+func (b *ChatBot) setUserToken(t *UserToken) {
+	b.tokenMu.Lock()
+	b.userToken = t
+	b.tokenMu.Unlock()
+
+	if b.TokenFile == "" {
+		return
+	}
+	err := SaveUserToken(b.TokenFile, t)
+	if err != nil {
+		log.Println("token:", err)
+	}
+}
+
+// Returns a copy of the current user token, or nil if there is none.
+func (b *ChatBot) currentUserToken() *UserToken {
+	b.tokenMu.Lock()
+	defer b.tokenMu.Unlock()
+	if b.userToken == nil {
+		return nil
+	}
+	t := *b.userToken
+	return &t
+}
+
+// Posts a grant to the OAuth token endpoint and installs the returned user
+// token. Every grant that produces a user token goes through here.
+func (b *ChatBot) requestUserToken(form url.Values) error {
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    Endpoint(b.AuthURL, "/oauth2/token"),
+		Body:   io.NopCloser(strings.NewReader(form.Encode())),
+		Header: http.Header{},
+	}
+	defer req.Body.Close()
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Client-ID", b.ClientID)
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	resBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		jsonResponse := &JSONErrorResponse{}
+		err = json.Unmarshal(resBody, jsonResponse)
+		if err != nil || jsonResponse.Message == "" {
+			return &TokenError{Status: response.StatusCode, Message: string(resBody)}
+		}
+		return &TokenError{Status: response.StatusCode, Message: jsonResponse.Message}
+	}
+
+	token := &UserToken{}
+	err = json.Unmarshal(resBody, token)
+	if err != nil {
+		return err
+	}
+	token.SetExpiry(time.Now())
+	b.setUserToken(token)
+
+	return nil
+}
+
+// Exchange the refresh token for a new access token.
+//
+// stale is the access token the caller saw fail. If another goroutine has
+// already replaced it the refresh is skipped, since Twitch rotates refresh
+// tokens and a second refresh with the old one would be rejected.
+//
+// https://dev.twitch.tv/docs/authentication/refresh-tokens/
+func (b *ChatBot) RefreshUserAuthToken(stale string) error {
+	b.refreshMu.Lock()
+	defer b.refreshMu.Unlock()
+
+	t := b.currentUserToken()
+	if t == nil {
+		return ErrTokenInvalid
+	}
+	if stale != "" && t.AccessToken != stale {
+		return nil
+	}
+	if t.RefreshToken == "" {
+		return errors.New("token: no refresh token available")
+	}
+
+	form := url.Values{}
+	form.Set("client_id", b.ClientID)
+	form.Set("client_secret", b.clientSecret)
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", t.RefreshToken)
+
+	err := b.requestUserToken(form)
+	if err != nil {
+		return err
+	}
+	log.Println("token: User token refreshed.")
+
+	return nil
+}
+
+// Refresh the user token ahead of its expiry and revalidate it on the
+// schedule Twitch asks for. Called periodically from Run.
+func (b *ChatBot) MaintainUserAuthToken(now time.Time) {
+	t := b.currentUserToken()
+	if t == nil {
+		return
+	}
+	if t.NeedsRefresh(now) {
+		err := b.RefreshUserAuthToken(t.AccessToken)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if now.Sub(b.tokenValidated) < TokenValidateInterval {
+		return
+	}
+	err := b.ValidateUserAuthToken()
+	if errors.Is(err, ErrTokenInvalid) {
+		err = b.RefreshUserAuthToken(t.AccessToken)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Try to resume from the token saved on disk, refreshing it if needed.
+// Returns false if the bot must go through the authorization flow again.
+func (b *ChatBot) LoadUserAuthToken() bool {
+	if b.TokenFile == "" {
+		return false
+	}
+	t, err := LoadUserToken(b.TokenFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println("token:", err)
+		}
+		return false
+	}
+
+	b.tokenMu.Lock()
+	b.userToken = t
+	b.tokenMu.Unlock()
+
+	if t.NeedsRefresh(time.Now()) {
+		err = b.RefreshUserAuthToken(t.AccessToken)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+	}
+
+	err = b.ValidateUserAuthToken()
+	if errors.Is(err, ErrTokenInvalid) {
+		err = b.RefreshUserAuthToken(t.AccessToken)
+		if err == nil {
+			err = b.ValidateUserAuthToken()
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	log.Println("token: Reusing saved user token.")
+	return true
+}
+
+// Sends a request authorized with the user token. If Twitch answers 401 the
+// token is refreshed and the request is rebuilt and sent once more.
+func (b *ChatBot) DoUserRequest(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		t := b.currentUserToken()
+		if t == nil {
+			return nil, ErrTokenInvalid
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		t.SetAuthHeader(req)
+		req.Header.Set("Client-ID", b.ClientID)
+
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return response, nil
+		}
+		response.Body.Close()
+
+		err = b.RefreshUserAuthToken(t.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
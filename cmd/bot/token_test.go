@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadUserToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	token := &UserToken{Scope: BotScopes}
+	token.AccessToken = "access"
+	token.RefreshToken = "refresh"
+	token.ExpiresIn = 3600
+	token.SetExpiry(time.Now())
+
+	err := SaveUserToken(path, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("token file has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadUserToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AccessToken != "access" || loaded.RefreshToken != "refresh" {
+		t.Fatalf("loaded token mismatch: %+v", loaded)
+	}
+	if !loaded.Expiry.Equal(token.Expiry) {
+		t.Fatalf("expiry %v, want %v", loaded.Expiry, token.Expiry)
+	}
+	if len(loaded.Scope) != len(BotScopes) {
+		t.Fatalf("scopes %v, want %v", loaded.Scope, BotScopes)
+	}
+}
+
+func TestUserTokenNeedsRefresh(t *testing.T) {
+	now := time.Now()
+	token := &UserToken{}
+
+	if token.NeedsRefresh(now) {
+		t.Fatal("token without expiry should not need a refresh")
+	}
+
+	token.ExpiresIn = 3600
+	token.SetExpiry(now)
+	if token.NeedsRefresh(now) {
+		t.Fatal("fresh token should not need a refresh")
+	}
+	if !token.NeedsRefresh(now.Add(time.Hour - TokenRefreshMargin/2)) {
+		t.Fatal("token inside the refresh margin should need a refresh")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Transport carries player commands into the game server and game messages
+// back out to players. The Twitch ChatBot is one; Terminal plays locally.
+type Transport interface {
+	// Connect to the game server's command channel, outbox and lifecycle
+	// channels. MUST be called before Run.
+	Attach(g *GameServer)
+
+	// Block until the transport or the game shuts down.
+	Run()
+}
+
+func NewTransport(name string, flow AuthFlow) (Transport, error) {
+	switch strings.ToLower(name) {
+	case "twitch", "":
+		return NewChatBot(flow), nil
+	case "terminal":
+		return NewTerminal(), nil
+	}
+	return nil, fmt.Errorf("transport: unknown transport %q (want twitch or terminal)", name)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrNoTrap = errors.New("no traps for level")
+
+// Chance a room is trapped.
+const TrapChance float32 = 0.15
+
+type Trap struct {
+	ID          int
+	Name        string
+	Difficulty  int // Agility penalty to dodge it
+	Description string
+	Effects     []Effect
+}
+
+func (g *GameServer) LoadTrap(id int) (Trap, error) {
+	t := Trap{ID: id}
+	err := g.Query[QueryTrap].QueryRow(id).Scan(&t.Name, &t.Difficulty, &t.Description)
+	if err != nil {
+		return t, fmt.Errorf("load trap %d: %w", id, err)
+	}
+	t.Effects, err = g.LoadEffects(QueryTrapEffects, id)
+	if err != nil {
+		return t, fmt.Errorf("load trap %d: %w", id, err)
+	}
+	return t, nil
+}
+
+// A random trap found at the dungeon level.
+func (g *GameServer) PickTrap(level int) (Trap, error) {
+	rows, err := g.Query[QueryTrapList].Query(level)
+	if err != nil {
+		return Trap{}, err
+	}
+	ids := make([]int, 0, 8)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return Trap{}, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return Trap{}, fmt.Errorf("%w %d", ErrNoTrap, level)
+	}
+	return g.LoadTrap(ids[g.Rand.IntN(len(ids))])
+}
+
+// Whoever walks in first makes an Agility check to dodge the trap. Returns
+// true if the party was moved or fell, so the room is no longer theirs.
+func (g *GameServer) SpringTrap(now time.Time) bool {
+	d := g.Delve
+	t, err := g.PickTrap(d.Level)
+	if err != nil {
+		log.Println("game:", err)
+		return false
+	}
+	standing := g.Standing()
+	if len(standing) == 0 {
+		return false
+	}
+	victim := standing[g.Rand.IntN(len(standing))]
+	name := g.Party.Name(victim)
+
+	if g.StatCheck(g.Party.PlayerCharacters[victim].Agility - t.Difficulty) {
+		g.Say(PriorityNormal, name+" spots a "+t.Name+" and leaps clear.")
+		return false
+	}
+	m := name + " springs a " + t.Name + "! " + t.Description
+	log.Println("game:", m)
+	g.Say(PriorityHigh, m)
+	room := d.Room()
+	g.ApplyEffects(t.Name, victim, "", t.Effects, now)
+
+	if g.Delve != d || d.Room() != room {
+		return true
+	}
+	return g.PartyFallen()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How long the party has to decide where to go next.
+const VoteWait = 15 * time.Second
+
+// The option that leaves the dungeon.
+const VoteHome = "home"
+
+// Options offered in rooms with stairs. There is no way up from the first
+// level but home.
+const (
+	VoteDown = "down"
+	VoteUp   = "up"
+)
+
+// The party deciding where to go next. Members may change their vote until
+// it closes.
+type Vote struct {
+	Options  []string          // In order of preference for breaking ties
+	Ballots  map[string]string // User ID -> option
+	Default  string            // Taken if no one votes
+	Deadline time.Time
+}
+
+// Offer the exits of the current room.
+func (g *GameServer) OpenVote(now time.Time) {
+	d := g.Delve
+	options := make([]string, 0, 6)
+	for _, dir := range d.Exits() {
+		options = append(options, DirectionNames[dir])
+	}
+	switch {
+	case d.Room().Stairs == StairDown:
+		options = append(options, VoteDown)
+	case d.Room().Stairs == StairUp && d.Level > 1:
+		options = append(options, VoteUp)
+	}
+	options = append(options, VoteHome)
+
+	d.Vote = &Vote{
+		Options:  options,
+		Ballots:  make(map[string]string, len(g.Party.Members)),
+		Default:  VoteHome,
+		Deadline: now.Add(g.VoteWait),
+	}
+
+	g.Say(PriorityNormal, fmt.Sprintf("Where to? !%s (%ds)",
+		strings.Join(options, " !"), int(g.VoteWait.Seconds())))
+}
+
+func (g *GameServer) CastVote(cmd Command, now time.Time) {
+	if g.Delve == nil || g.Delve.Vote == nil || !g.Party.IsMember(cmd.UserID) {
+		return
+	}
+	v := g.Delve.Vote
+
+	if !slices.Contains(v.Options, cmd.Verb) {
+		g.Say(PriorityNormal, fmt.Sprintf("@%s there is no way %s. Try !%s",
+			cmd.Name(), cmd.Verb, strings.Join(v.Options, " !")))
+		return
+	}
+	v.Ballots[cmd.UserID] = cmd.Verb
+
+	if v.Decided(len(g.Party.Members)) {
+		g.CloseVote(now)
+	}
+}
+
+// True once an option has a majority or everyone has voted.
+func (v *Vote) Decided(members int) bool {
+	if len(v.Ballots) >= members {
+		return true
+	}
+	for _, n := range v.Count() {
+		if n > members/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Votes per option.
+func (v *Vote) Count() map[string]int {
+	counts := make(map[string]int, len(v.Options))
+	for _, option := range v.Ballots {
+		counts[option]++
+	}
+	return counts
+}
+
+// The option with the most votes. Ties go to the leader's choice if it is
+// among them, otherwise to the first in option order.
+func (v *Vote) Winner(leader string) string {
+	counts := v.Count()
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	if most == 0 {
+		return v.Default
+	}
+
+	if choice, ok := v.Ballots[leader]; ok && counts[choice] == most {
+		return choice
+	}
+	for _, option := range v.Options {
+		if counts[option] == most {
+			return option
+		}
+	}
+	return v.Default
+}
+
+func (g *GameServer) CloseVote(now time.Time) {
+	d := g.Delve
+	v := d.Vote
+	d.Vote = nil
+
+	choice := v.Winner(g.Party.Leader)
+	if choice == VoteHome {
+		m := "The party returns to Goblin Town."
+		if len(v.Ballots) == 0 {
+			m = "No one speaks up. The party returns to Goblin Town."
+		}
+		log.Println("game:", m)
+		g.Say(PriorityHigh, m)
+		g.ReturnHome()
+		return
+	}
+
+	d.Light = max(0, d.Light-1)
+	m := "The party heads " + choice + "."
+	switch choice {
+	case VoteDown:
+		d.ChangeLevel(1)
+		m = fmt.Sprintf("The party takes the stairs down to level %d.", d.Level)
+	case VoteUp:
+		d.ChangeLevel(-1)
+		m = fmt.Sprintf("The party climbs the stairs up to level %d.", d.Level)
+	default:
+		d.Move(slices.Index(DirectionNames, choice))
+	}
+	log.Println("game:", m)
+	g.Say(PriorityNormal, m)
+
+	g.EnterRoom(now)
+}
+
+// Arrive in the current room. Room events come first, then the vote.
+func (g *GameServer) EnterRoom(now time.Time) {
+	room := g.Delve.Room()
+	room.Visited = true
+
+	if room.Trap {
+		room.Trap = false
+		if g.SpringTrap(now) {
+			return
+		}
+	}
+
+	if room.Monster && room.MonsterID == 0 {
+		m, err := g.PickMonster(g.Delve.Level)
+		if err != nil {
+			log.Println("game:", err)
+			room.Monster = false
+		}
+		room.MonsterID = m.ID
+	}
+	if room.Monster {
+		m, err := g.LoadMonster(room.MonsterID)
+		if err == nil && g.Rand.Float64() < m.Awareness {
+			g.StartCombat(m, true, true, now)
+			return
+		} else if err == nil {
+			g.OpenEncounter(m, now)
+			return
+		}
+		log.Println("game:", err)
+	}
+
+	g.OpenVote(now)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A party of Alice (leader) and Bob standing in the first room of a dungeon
+// with no monsters.
+func newTestDelve(t *testing.T) (*GameServer, time.Time) {
+	t.Helper()
+	g := newTestGameServer(t)
+	t.Cleanup(func() {
+		CloseQuery(g.Query)
+		g.DB.Close()
+	})
+	now := time.Now()
+
+	sendCommand(t, g, "1", "Alice", "!join", now)
+	sendCommand(t, g, "2", "Bob", "!join", now)
+	sendCommand(t, g, "1", "Alice", "!begin", now)
+	if g.Delve == nil || g.Delve.Vote == nil {
+		t.Fatal("no vote after entering the dungeon")
+	}
+	for i := range g.Delve.Chunk.Rooms {
+		g.Delve.Chunk.Rooms[i].Monster = false
+		g.Delve.Chunk.Rooms[i].Trap = false
+	}
+	drainChat(g)
+	return g, now
+}
+
+func TestDungeonExits(t *testing.T) {
+	for seed := range uint64(50) {
+		d := NewDungeon(seed)
+		if d.RoomPos.X >= CHUNKSIZEROOT || d.RoomPos.Y >= CHUNKSIZEROOT {
+			t.Fatalf("seed %d: start %v is outside the chunk", seed, d.RoomPos)
+		}
+		exits := d.Exits()
+		if len(exits) == 0 {
+			t.Fatalf("seed %d: starting room has no exits", seed)
+		}
+		for _, dir := range exits {
+			from := d.RoomPos
+			d.Move(dir)
+			if !slices.Contains(d.Exits(), OppositeDirection(dir)) {
+				t.Fatalf("seed %d: no way back %s from %v", seed, DirectionNames[dir], from)
+			}
+			d.RoomPos = from
+		}
+	}
+}
+
+func TestVoteOnlyRealExits(t *testing.T) {
+	g, now := newTestDelve(t)
+	room := g.Delve.Room()
+	if len(g.Delve.Exits()) == len(room.Doors) {
+		// Brick up a door so there is a way that does not exist.
+		room.Doors[len(room.Doors)-1] = DoorNone
+		g.OpenVote(now)
+		drainChat(g)
+	}
+	exits := g.Delve.Exits()
+
+	for dir, name := range DirectionNames {
+		if slices.Contains(exits, dir) {
+			continue
+		}
+		sendCommand(t, g, "2", "Bob", "!"+name, now)
+		if _, ok := g.Delve.Vote.Ballots["2"]; ok {
+			t.Fatalf("vote for missing exit %s was counted", name)
+		}
+		if chat := drainChat(g); !strings.Contains(chat, "there is no way "+name) {
+			t.Fatalf("unexpected chat:\n%s", chat)
+		}
+		return
+	}
+	t.Fatal("no missing exit to vote for")
+}
+
+func TestVoteMajorityMoves(t *testing.T) {
+	g, now := newTestDelve(t)
+	dir := g.Delve.Exits()[0]
+	want := g.Delve.RoomPos.Step(dir)
+
+	sendCommand(t, g, "2", "Bob", "!home", now)
+	sendCommand(t, g, "2", "Bob", "!"+DirectionNames[dir], now)
+	if g.Delve.Vote == nil {
+		t.Fatal("one of two votes is not a majority")
+	}
+	sendCommand(t, g, "1", "Alice", "!"+DirectionNames[dir], now)
+
+	if g.Delve.RoomPos != want {
+		t.Fatalf("party is at %v, want %v", g.Delve.RoomPos, want)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "The party heads "+DirectionNames[dir]) {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if g.Delve.Vote == nil {
+		t.Fatal("a new vote should open in the next room")
+	}
+}
+
+func TestStairsChangeLevel(t *testing.T) {
+	g, now := newTestDelve(t)
+	g.Delve.Room().Stairs = StairDown
+	g.OpenVote(now)
+	if !slices.Contains(g.Delve.Vote.Options, VoteDown) {
+		t.Fatalf("no way down the stairs: %v", g.Delve.Vote.Options)
+	}
+
+	sendCommand(t, g, "1", "Alice", "!down", now)
+	sendCommand(t, g, "2", "Bob", "!down", now)
+	if g.Delve.Level != 2 {
+		t.Fatalf("party is on level %d, want 2", g.Delve.Level)
+	}
+	if chat := drainChat(g); !strings.Contains(chat, "down to level 2") {
+		t.Fatalf("unexpected chat:\n%s", chat)
+	}
+	if g.Delve.Vote == nil || !slices.Contains(g.Delve.Vote.Options, VoteUp) {
+		t.Fatal("no way back up the stairs")
+	}
+
+	deeper := false
+	for range 100 {
+		m, err := g.PickMonster(g.Delve.Level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Name == "Ogre" {
+			t.Fatal("Ogre is too tough for level 2")
+		}
+		deeper = deeper || m.Name == "Skeleton" || m.Name == "Hobgoblin"
+	}
+	if !deeper {
+		t.Fatal("level 2 has only level 1 monsters")
+	}
+
+	sendCommand(t, g, "1", "Alice", "!up", now)
+	sendCommand(t, g, "2", "Bob", "!up", now)
+	if g.Delve.Level != 1 {
+		t.Fatalf("party is on level %d, want 1", g.Delve.Level)
+	}
+}
+
+func TestVoteTieGoesToLeader(t *testing.T) {
+	g, now := newTestDelve(t)
+	dir := g.Delve.Exits()[0]
+	start := g.Delve.RoomPos
+
+	sendCommand(t, g, "2", "Bob", "!home", now)
+	sendCommand(t, g, "1", "Alice", "!"+DirectionNames[dir], now)
+	if g.Delve == nil || g.Delve.RoomPos != start.Step(dir) {
+		t.Fatal("tie should go to the leader's choice")
+	}
+}
+
+func TestVoteTimeout(t *testing.T) {
+	g, now := newTestDelve(t)
+
+	g.Update(now.Add(g.VoteWait - time.Second))
+	if g.Delve == nil || g.Delve.Vote == nil {
+		t.Fatal("vote closed early")
+	}
+
+	dir := g.Delve.Exits()[0]
+	sendCommand(t, g, "2", "Bob", "!"+DirectionNames[dir], now)
+	g.Update(now.Add(g.VoteWait))
+	if g.Delve == nil || g.Delve.RoomPos == (Position{2, 2}) {
+		t.Fatal("party should follow the only vote cast")
+	}
+
+	g.Update(now.Add(3 * g.VoteWait))
+	if g.Phase != PhaseTown || g.Delve != nil {
+		t.Fatal("a vote nobody took part in should send the party home")
+	}
+}